@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adsmf/adventofcode2019/utils/intcode"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run loads and runs the program named in args, returning the exit code
+//
+// Input is taken from -input and then -input-file, or from stdin if neither is given. With -repl,
+// stdin is read by an intcode.REPL instead.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("intcode", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: intcode [flags] program-file")
+		flags.PrintDefaults()
+	}
+	var (
+		inputValues     = flags.String("input", "", "Values to input, comma separated, or text in ASCII mode with \\n for newlines")
+		inputFile       = flags.String("input-file", "", "File to read input from instead of stdin")
+		ascii           = flags.Bool("ascii", false, "Read input as text and print outputs as characters, other than non-ASCII values")
+		modelName       = flags.String("model", intcode.M19Model.Name(), "Name of the machine model")
+		maxInstructions = flags.Int("max", 0, "Stop after this many instructions, or 0 for no limit; with -repl, for each run between inputs")
+		timeout         = flags.Duration("timeout", 0, "Stop after this long, or 0 for no limit")
+		quiet           = flags.Bool("quiet", false, "Do not report how the run stopped")
+		replMode        = flags.Bool("repl", false, "Run interactively, inputting lines from stdin as ASCII, with : meta-commands (try :help)")
+		patches         = ramPatches{}
+		reads           = addressList{}
+	)
+	flags.Var(patches, "set", "Store a value in RAM before running, as address=value; may be repeated")
+	flags.Var(&reads, "read", "Print the value at an address after running; may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if *replMode {
+		if *inputFile != "" {
+			fmt.Fprintln(stderr, "Cannot read input from a file with -repl")
+			return 2
+		}
+		*ascii = true
+	}
+
+	model, found := intcode.LookupModel(*modelName)
+	if !found {
+		fmt.Fprintf(stderr, "Unknown model: %s\n", *modelName)
+		return 2
+	}
+	program, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var source io.Reader
+	switch {
+	case *inputFile != "":
+		file, err := os.Open(*inputFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer file.Close()
+		source = file
+	case *inputValues == "" && !*replMode:
+		source = stdin
+	}
+	var queued []int
+	var inputCB intcode.InputCallback
+	var outputCB intcode.OutputCallback
+	numeric := &numericInput{}
+	// A failed write to stdout stops the run, rather than leaving the program running unheard
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	var writeErr error
+	printValue := func(value int) {
+		if writeErr == nil {
+			if _, writeErr = fmt.Fprintln(stdout, value); writeErr != nil {
+				stop()
+			}
+		}
+	}
+	var writer *intcode.ASCIIWriter
+	if *ascii {
+		for _, char := range []byte(strings.Replace(*inputValues, `\n`, "\n", -1)) {
+			queued = append(queued, int(char))
+		}
+		if source != nil {
+			inputCB = intcode.ReaderInput(source)
+		}
+		writer = intcode.NewASCIIWriter(stdout, printValue)
+		outputCB = func(value int) {
+			writer.Output(value)
+			if writer.Err() != nil {
+				stop()
+			}
+		}
+	} else {
+		if queued, err = parseValues(*inputValues); err != nil {
+			fmt.Fprintf(stderr, "Invalid input: %v\n", err)
+			return 2
+		}
+		if source != nil {
+			numeric.scanner = newValueScanner(source)
+			inputCB = numeric.next
+		}
+		outputCB = printValue
+	}
+
+	m := intcode.NewMachine(intcode.WithModel(model, inputCB, outputCB))
+	if err := m.LoadProgram(string(program)); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := m.WriteMemory(patches); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	m.QueueInput(queued...)
+	if *replMode {
+		r, err := intcode.NewREPL(&m, stdout)
+		if err == nil {
+			r.MaxInstructions = *maxInstructions
+			// Ctrl-C stops the running program rather than the REPL
+			interrupts := make(chan os.Signal, 1)
+			signal.Notify(interrupts, os.Interrupt)
+			defer signal.Stop(interrupts)
+			err = r.Run(stdin, interrupts)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	reason, err := m.RunLimited(ctx, *maxInstructions, false)
+	elapsed := time.Since(start)
+
+	memory := m.Memory()
+	for _, addr := range reads {
+		fmt.Fprintln(stdout, memory[addr])
+	}
+	if !*quiet {
+		fmt.Fprintf(stderr, "Stopped (%v) after %d instructions in %v\n", reason, m.InstructionCount(), elapsed)
+	}
+	if numeric.err != nil {
+		err = numeric.err
+	}
+	if writer != nil && writer.Err() != nil {
+		writeErr = writer.Err()
+	}
+	if writeErr != nil {
+		err = writeErr
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if reason != intcode.StopHalted {
+		return 1
+	}
+	return 0
+}
+
+// ramPatches holds values to store before running, by address
+type ramPatches map[int]int
+
+func (p ramPatches) String() string {
+	addrs := []int{}
+	for addr := range p {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+	patches := make([]string, len(addrs))
+	for i, addr := range addrs {
+		patches[i] = fmt.Sprintf("%d=%d", addr, p[addr])
+	}
+	return strings.Join(patches, ",")
+}
+
+func (p ramPatches) Set(patch string) error {
+	parts := strings.SplitN(patch, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Expected address=value, got %q", patch)
+	}
+	addr, err := parseAddress(parts[0])
+	if err != nil {
+		return err
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return err
+	}
+	p[addr] = value
+	return nil
+}
+
+// addressList holds addresses to print after running, in order
+type addressList []int
+
+func (a *addressList) String() string {
+	return fmt.Sprint([]int(*a))
+}
+
+func (a *addressList) Set(value string) error {
+	addr, err := parseAddress(value)
+	if err != nil {
+		return err
+	}
+	*a = append(*a, addr)
+	return nil
+}
+
+func parseAddress(value string) (int, error) {
+	addr, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	if addr < 0 {
+		return 0, fmt.Errorf("Negative address %d", addr)
+	}
+	return addr, nil
+}
+
+// parseValues reads integers separated by commas or whitespace
+func parseValues(text string) ([]int, error) {
+	values := []int{}
+	scanner := newValueScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		value, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, scanner.Err()
+}
+
+// newValueScanner splits input into tokens separated by commas or whitespace
+func newValueScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	isSeparator := func(b byte) bool {
+		return b == ',' || b == ' ' || b == '\t' || b == '\r' || b == '\n'
+	}
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		start := 0
+		for start < len(data) && isSeparator(data[start]) {
+			start++
+		}
+		for end := start; end < len(data); end++ {
+			if isSeparator(data[end]) {
+				return end + 1, data[start:end], nil
+			}
+		}
+		if atEOF && start < len(data) {
+			return len(data), data[start:], nil
+		}
+		return start, nil, nil
+	})
+	return scanner
+}
+
+// numericInput reads input values on demand, so that a program can be driven interactively
+type numericInput struct {
+	scanner *bufio.Scanner
+	err     error
+}
+
+func (n *numericInput) next() (int, bool) {
+	if !n.scanner.Scan() {
+		n.err = n.scanner.Err()
+		return 0, true
+	}
+	value, err := strconv.Atoi(n.scanner.Text())
+	if err != nil {
+		n.err = fmt.Errorf("Invalid input: %v", err)
+		return 0, true
+	}
+	return value, false
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	type testDef struct {
+		args   []string
+		stdin  string
+		stdout string
+		rc     int
+	}
+	tests := []testDef{
+		{
+			args:   []string{"-set", "1=12", "-set", "2=2", "-read", "0", "-model", "D02", "../../day02/input.txt"},
+			stdout: "3224742\n",
+		},
+		{
+			args:   []string{"-input", "1", "../../day09/input.txt"},
+			stdout: "3063082071\n",
+		},
+		{
+			args:   []string{"../../day09/input.txt"},
+			stdin:  "2\n",
+			stdout: "81348\n",
+		},
+		{
+			args:   []string{"-input-file", "../../day05/input.txt", "-max", "5", "../../day09/input.txt"},
+			stdout: "",
+			rc:     1,
+		},
+		{
+			args:   []string{"-input", "x", "../../day09/input.txt"},
+			stdout: "",
+			rc:     2,
+		},
+		{
+			args:   []string{"-model", "D02", "-read", "0", "-read", "-1", "../../day02/input.txt"},
+			stdout: "",
+			rc:     2,
+		},
+		{
+			args:   []string{"missing.txt"},
+			stdout: "",
+			rc:     1,
+		},
+		{
+			args:   []string{},
+			stdout: "",
+			rc:     2,
+		},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			rc := run(test.args, strings.NewReader(test.stdin), stdout, stderr)
+			assert.Equal(t, test.rc, rc, stderr.String())
+			assert.Equal(t, test.stdout, stdout.String())
+		})
+	}
+}
+
+func TestRunASCII(t *testing.T) {
+	commands := strings.Join([]string{
+		"A,B,A,B,C,C,B,A,B,C",
+		"L,8,R,12,R,12,R,10",
+		"R,10,R,12,R,10",
+		"L,10,R,10,L,6",
+		"n",
+	}, "\n") + "\n"
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	rc := run([]string{"-ascii", "-set", "0=2", "../../day17/input.txt"}, strings.NewReader(commands), stdout, stderr)
+	assert.Equal(t, 0, rc)
+	assert.Contains(t, stdout.String(), "\nMain:\n")
+	assert.True(t, strings.HasSuffix(stdout.String(), "\n945911\n"))
+	assert.Regexp(t, `^Stopped \(halted\) after \d+ instructions in \S+\n$`, stderr.String())
+
+	stdout.Reset()
+	rc = run([]string{"-ascii", "-quiet", "-set", "0=2", "-input", `A\nL,8\n`, "../../day17/input.txt"}, nil, stdout, &bytes.Buffer{})
+	assert.Equal(t, 1, rc)
+	assert.True(t, strings.HasSuffix(stdout.String(), "\nFunction B:\n"))
+}
+
+func TestRunREPL(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	commands := strings.Join([]string{
+		":save start",
+		"A",
+		":restore start",
+		":history",
+		":peek 0",
+		":quit",
+	}, "\n")
+	rc := run([]string{"-repl", "-set", "0=2", "../../day17/input.txt"}, strings.NewReader(commands), stdout, stderr)
+	assert.Equal(t, 0, rc, stderr.String())
+	assert.True(t, strings.HasSuffix(stdout.String(), "\nMain:\nFunction A:\nRestored start at instruction 37654\n#0000:\t2\n"))
+
+	stdout.Reset()
+	rc = run([]string{"-repl", "-max", "5", "../../day17/input.txt"}, strings.NewReader(":continue\n"), stdout, stderr)
+	assert.Equal(t, 0, rc, stderr.String())
+	assert.Equal(t, "Stopped after 5 instructions: budget exhausted (try :continue)\n"+
+		"Stopped after 10 instructions: budget exhausted (try :continue)\n", stdout.String())
+
+	rc = run([]string{"-repl", "-input-file", "x", "../../day17/input.txt"}, nil, stdout, stderr)
+	assert.Equal(t, 2, rc)
+}
+
+// closedWriter fails every write, as a closed pipe would
+type closedWriter struct{}
+
+func (closedWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("Closed pipe")
+}
+
+func TestRunClosedOutput(t *testing.T) {
+	for _, args := range [][]string{
+		{"-ascii", "../../day17/input.txt"},
+		{"-input", "1", "../../day09/input.txt"},
+	} {
+		stderr := &bytes.Buffer{}
+		rc := run(args, nil, closedWriter{}, stderr)
+		assert.Equal(t, 1, rc)
+		assert.Contains(t, stderr.String(), "Closed pipe")
+	}
+}
@@ -30,7 +30,7 @@ func part2() int {
 }
 
 func runInput(input1, input2 int) int {
-	m := intcode.NewMachine(intcode.M19(nil, nil))
+	m := intcode.NewMachine(intcode.Day2())
 	m.LoadProgram(loadInputString())
 	m.WriteRAM(1, input1)
 	m.WriteRAM(2, input2)
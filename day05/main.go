@@ -24,7 +24,7 @@ func runInput(input int) int {
 	inputCB := func() (int, bool) {
 		return input, false
 	}
-	m := intcode.NewMachine(intcode.M19(inputCB, nil))
+	m := intcode.NewMachine(intcode.Day5(inputCB, nil))
 	m.LoadProgram(loadInputString())
 	m.Run(false)
 	return m.Register(intcode.M19RegisterOutput)
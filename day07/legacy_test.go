@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adsmf/adventofcode2019/utils/intcode"
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyMachine is the interpreter used before moving to utils/intcode, kept as a reference
+type legacyMachine struct {
+	headPos int
+	values  map[int]int
+	inputs  <-chan int
+	outputs chan<- int
+}
+
+func newLegacyMachine(initial string, inputs <-chan int, output chan<- int) legacyMachine {
+	initialValueStrings := strings.Split(strings.TrimSpace(initial), ",")
+	initialValues := map[int]int{}
+	for pos, valString := range initialValueStrings {
+		val, err := strconv.Atoi(valString)
+		if err != nil {
+			panic(err)
+		}
+		initialValues[pos] = val
+	}
+	mach := legacyMachine{
+		values:  initialValues,
+		headPos: 0,
+		inputs:  inputs,
+		outputs: output,
+	}
+	return mach
+}
+
+func (t *legacyMachine) run() {
+	for {
+		done := t.step()
+		if done {
+			return
+		}
+	}
+}
+
+func (t *legacyMachine) step() bool {
+	initialHead := t.headPos
+	oper := t.values[initialHead]
+	paramModes := int(oper / 100)
+	oper = oper % 100
+	switch oper {
+	case 1:
+		// Add
+		params := t.getParams(paramModes, 3, true)
+		p1 := params[0]
+		p2 := params[1]
+		p3 := params[2]
+
+		t.values[p3] = p1 + p2
+	case 2:
+		// Mult
+		params := t.getParams(paramModes, 3, true)
+		p1 := params[0]
+		p2 := params[1]
+		p3 := params[2]
+
+		t.values[p3] = p1 * p2
+	case 3:
+		// Input
+		params := t.getParams(paramModes, 1, true)
+		p := params[0]
+
+		nextInput := <-t.inputs
+		t.values[p] = nextInput
+	case 4:
+		// Output
+		params := t.getParams(paramModes, 1, false)
+		p := params[0]
+
+		t.outputs <- p
+	case 5:
+		// JNZ
+		params := t.getParams(paramModes, 2, false)
+		p1 := params[0]
+		p2 := params[1]
+
+		if p1 != 0 {
+			t.headPos = p2
+		}
+	case 6:
+		// JEZ
+		params := t.getParams(paramModes, 2, false)
+		p1 := params[0]
+		p2 := params[1]
+
+		if p1 == 0 {
+			t.headPos = p2
+		}
+	case 7:
+		// CLT
+		params := t.getParams(paramModes, 3, true)
+		p1 := params[0]
+		p2 := params[1]
+		p3 := params[2]
+
+		if p1 < p2 {
+			t.values[p3] = 1
+		} else {
+			t.values[p3] = 0
+		}
+	case 8:
+		// CMP
+		params := t.getParams(paramModes, 3, true)
+		p1 := params[0]
+		p2 := params[1]
+		p3 := params[2]
+
+		if p1 == p2 {
+			t.values[p3] = 1
+		} else {
+			t.values[p3] = 0
+		}
+	case 99:
+		// HCF
+		return true
+	default:
+		panic(fmt.Errorf("Invalid opcode %d at position %d: %#v", oper, t.headPos, t))
+	}
+	return false
+}
+
+func (t *legacyMachine) getParams(paramModes, numParams int, hasOutput bool) []int {
+	params := []int{}
+	for param := 0; param < numParams; param++ {
+		lastParam := (param == numParams-1)
+		p := t.getVal(t.headPos + param + 1)
+		if !hasOutput || !lastParam {
+			if paramMode(paramModes, param) == 0 {
+				p = t.getVal(p)
+			}
+		}
+		params = append(params, p)
+	}
+
+	t.headPos = t.headPos + numParams + 1
+	return params
+}
+
+func paramMode(modes, pos int) int {
+	mask := int(math.Pow(10, float64(pos)))
+	return (modes / mask) % 10
+}
+
+func (t *legacyMachine) getVal(pos int) int {
+	if pos >= len(t.values) {
+		return 0
+	}
+	return t.values[pos]
+}
+
+func (t *legacyMachine) String() string {
+	valueStrings := []string{}
+	keys := []int{}
+	for key := range t.values {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	for _, key := range keys {
+		valueStrings = append(valueStrings, strconv.Itoa(t.values[key]))
+	}
+	return strings.Join(valueStrings, ",")
+}
+
+func (t *legacyMachine) Step() bool {
+	return t.step()
+}
+
+func (t *legacyMachine) InstructionPointer() int {
+	return t.headPos
+}
+
+func (t *legacyMachine) Memory() map[int]int {
+	values := map[int]int{}
+	for addr, value := range t.values {
+		values[addr] = value
+	}
+	return values
+}
+
+func TestLegacyDifferential(t *testing.T) {
+	type testDef struct {
+		program string
+		inputs  []int
+	}
+	tests := []testDef{
+		{"3,15,3,16,1002,16,10,16,1,16,15,15,4,15,99,0,0", []int{4, 0}},
+		{"3,23,3,24,1002,24,10,24,1002,23,-1,23,101,5,23,23,1,24,23,23,4,23,99,0,0", []int{1, 12}},
+		{"3,9,8,9,10,9,4,9,99,-1,8", []int{8}},
+	}
+	for phase := 0; phase < 5; phase++ {
+		tests = append(tests, testDef{loadInputString(), []int{phase, 17}})
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			legacyInputs := make(chan int, len(test.inputs))
+			inputs := make(chan int, len(test.inputs))
+			for _, input := range test.inputs {
+				legacyInputs <- input
+				inputs <- input
+			}
+			legacy := newLegacyMachine(test.program, legacyInputs, make(chan int, 100))
+			shared := newMachine(test.program, inputs, make(chan int, 100))
+			divergence := intcode.Compare(&shared.Machine, &legacy, 100000)
+			assert.Nil(t, divergence, "%v", divergence)
+		})
+	}
+}
@@ -3,13 +3,13 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
-	"math"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/adsmf/adventofcode2019/utils"
+	"github.com/adsmf/adventofcode2019/utils/intcode"
 )
 
 // var debug = debugPrintf
@@ -108,164 +108,31 @@ func loadInputString() string {
 }
 
 type machine struct {
-	headPos int
-	values  map[int]int
-	inputs  <-chan int
-	outputs chan<- int
+	intcode.Machine
 }
 
 func newMachine(initial string, inputs <-chan int, output chan<- int) machine {
-	initialValueStrings := strings.Split(strings.TrimSpace(initial), ",")
-	initialValues := map[int]int{}
-	for pos, valString := range initialValueStrings {
-		val, err := strconv.Atoi(valString)
-		if err != nil {
-			panic(err)
-		}
-		initialValues[pos] = val
-	}
-	mach := machine{
-		values:  initialValues,
-		headPos: 0,
-		inputs:  inputs,
-		outputs: output,
+	m := intcode.NewMachine(intcode.Channels(inputs, output), intcode.DenseMemory())
+	if err := m.LoadProgram(initial); err != nil {
+		panic(err)
 	}
-	return mach
+	return machine{m}
 }
 
 func (t *machine) run() {
-	for {
-		done := t.step()
-		if done {
-			return
-		}
-	}
-}
-
-func (t *machine) step() bool {
-	initialHead := t.headPos
-	oper := t.values[initialHead]
-	paramModes := int(oper / 100)
-	oper = oper % 100
-	switch oper {
-	case 1:
-		// Add
-		params := t.getParams(paramModes, 3, true)
-		p1 := params[0]
-		p2 := params[1]
-		p3 := params[2]
-
-		t.values[p3] = p1 + p2
-	case 2:
-		// Mult
-		params := t.getParams(paramModes, 3, true)
-		p1 := params[0]
-		p2 := params[1]
-		p3 := params[2]
-
-		t.values[p3] = p1 * p2
-	case 3:
-		// Input
-		params := t.getParams(paramModes, 1, true)
-		p := params[0]
-
-		nextInput := <-t.inputs
-		t.values[p] = nextInput
-	case 4:
-		// Output
-		params := t.getParams(paramModes, 1, false)
-		p := params[0]
-
-		t.outputs <- p
-	case 5:
-		// JNZ
-		params := t.getParams(paramModes, 2, false)
-		p1 := params[0]
-		p2 := params[1]
-
-		if p1 != 0 {
-			t.headPos = p2
-		}
-	case 6:
-		// JEZ
-		params := t.getParams(paramModes, 2, false)
-		p1 := params[0]
-		p2 := params[1]
-
-		if p1 == 0 {
-			t.headPos = p2
-		}
-	case 7:
-		// CLT
-		params := t.getParams(paramModes, 3, true)
-		p1 := params[0]
-		p2 := params[1]
-		p3 := params[2]
-
-		if p1 < p2 {
-			t.values[p3] = 1
-		} else {
-			t.values[p3] = 0
-		}
-	case 8:
-		// CMP
-		params := t.getParams(paramModes, 3, true)
-		p1 := params[0]
-		p2 := params[1]
-		p3 := params[2]
-
-		if p1 == p2 {
-			t.values[p3] = 1
-		} else {
-			t.values[p3] = 0
-		}
-	case 99:
-		// HCF
-		return true
-	default:
-		panic(fmt.Errorf("Invalid opcode %d at position %d: %#v", oper, t.headPos, t))
-	}
-	return false
-}
-
-func (t *machine) getParams(paramModes, numParams int, hasOutput bool) []int {
-	params := []int{}
-	for param := 0; param < numParams; param++ {
-		lastParam := (param == numParams-1)
-		p := t.getVal(t.headPos + param + 1)
-		if !hasOutput || !lastParam {
-			if paramMode(paramModes, param) == 0 {
-				p = t.getVal(p)
-			}
-		}
-		params = append(params, p)
-	}
-
-	t.headPos = t.headPos + numParams + 1
-	return params
-}
-
-func paramMode(modes, pos int) int {
-	mask := int(math.Pow(10, float64(pos)))
-	return (modes / mask) % 10
-}
-
-func (t *machine) getVal(pos int) int {
-	if pos >= len(t.values) {
-		return 0
-	}
-	return t.values[pos]
+	t.Run(false)
 }
 
 func (t *machine) String() string {
-	valueStrings := []string{}
+	values := t.Memory()
 	keys := []int{}
-	for key := range t.values {
+	for key := range values {
 		keys = append(keys, key)
 	}
 	sort.Ints(keys)
+	valueStrings := []string{}
 	for _, key := range keys {
-		valueStrings = append(valueStrings, strconv.Itoa(t.values[key]))
+		valueStrings = append(valueStrings, strconv.Itoa(values[key]))
 	}
 	return strings.Join(valueStrings, ",")
 }
@@ -2,22 +2,17 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
 	"sort"
 	"strconv"
 	"strings"
-)
-
-func loadInputString() string {
-	inputRaw, err := ioutil.ReadFile("input.txt")
-	if err != nil {
-		panic(err)
-	}
-	return string(inputRaw)
+	"testing"
 
-}
+	"github.com/adsmf/adventofcode2019/utils/intcode"
+	"github.com/stretchr/testify/assert"
+)
 
-type machine struct {
+// legacyMachine is the interpreter used before moving to utils/intcode, kept as a reference
+type legacyMachine struct {
 	headPos      int64
 	values       map[int64]int64
 	inputs       <-chan int64
@@ -25,7 +20,7 @@ type machine struct {
 	relativeBase int64
 }
 
-func newMachine(initial string, inputs <-chan int64, output chan<- int64) machine {
+func newLegacyMachine(initial string, inputs <-chan int64, output chan<- int64) legacyMachine {
 	initialValueStrings := strings.Split(strings.TrimSpace(initial), ",")
 	initialValues := map[int64]int64{}
 	for pos, valString := range initialValueStrings {
@@ -35,7 +30,7 @@ func newMachine(initial string, inputs <-chan int64, output chan<- int64) machin
 		}
 		initialValues[int64(pos)] = int64(val)
 	}
-	mach := machine{
+	mach := legacyMachine{
 		values:  initialValues,
 		headPos: 0,
 		inputs:  inputs,
@@ -44,7 +39,7 @@ func newMachine(initial string, inputs <-chan int64, output chan<- int64) machin
 	return mach
 }
 
-func (t *machine) run() {
+func (t *legacyMachine) run() {
 	for {
 		done := t.step()
 		if done {
@@ -53,7 +48,7 @@ func (t *machine) run() {
 	}
 }
 
-func (t *machine) step() bool {
+func (t *legacyMachine) step() bool {
 	initialHead := t.headPos
 	oper := t.values[initialHead]
 	paramModes := int64(oper / 100)
@@ -145,7 +140,7 @@ func (t *machine) step() bool {
 	return false
 }
 
-func (t *machine) getParamAddresses(paramModes, numParams int64) []int64 {
+func (t *legacyMachine) getParamAddresses(paramModes, numParams int64) []int64 {
 	params := make([]int64, numParams)
 	for param := int64(0); param < numParams; param++ {
 		pAddress := t.headPos + param + 1
@@ -170,7 +165,7 @@ func (t *machine) getParamAddresses(paramModes, numParams int64) []int64 {
 	return params
 }
 
-func (t *machine) String() string {
+func (t *legacyMachine) String() string {
 	valueStrings := []string{}
 	keys := []int{}
 	for key := range t.values {
@@ -182,3 +177,40 @@ func (t *machine) String() string {
 	}
 	return strings.Join(valueStrings, ",")
 }
+
+func (t *legacyMachine) Step() bool {
+	return t.step()
+}
+
+func (t *legacyMachine) InstructionPointer() int {
+	return int(t.headPos)
+}
+
+func (t *legacyMachine) Memory() map[int]int {
+	values := map[int]int{}
+	for addr, value := range t.values {
+		values[int(addr)] = int(value)
+	}
+	return values
+}
+
+func TestLegacyDifferential(t *testing.T) {
+	for _, startingPanel := range []int{0, 1} {
+		t.Run(fmt.Sprintf("Panel %d", startingPanel), func(t *testing.T) {
+			// Each instruction reads or writes at most one value, so the channels can never block
+			const maxInstructions = 20000
+			program := loadInputString()
+			legacyInputs := make(chan int64, maxInstructions)
+			shared := intcode.NewMachine(intcode.M19(nil, nil), intcode.DenseMemory())
+			assert.NoError(t, shared.LoadProgram(program))
+			for i := 0; i < maxInstructions; i++ {
+				input := (i + startingPanel) % 2
+				legacyInputs <- int64(input)
+				shared.QueueInput(input)
+			}
+			legacy := newLegacyMachine(program, legacyInputs, make(chan int64, maxInstructions))
+			divergence := intcode.Compare(&shared, &legacy, maxInstructions)
+			assert.Nil(t, divergence, "%v", divergence)
+		})
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"sync"
+
+	"github.com/adsmf/adventofcode2019/utils/intcode"
 )
 
 func main() {
@@ -113,14 +116,14 @@ func (f facing) left() facing {
 	return facing(f - 1)
 }
 
-func runPainter(program string, startingPanel int64) shipHull {
+func runPainter(program string, startingPanel int) shipHull {
 	hull := shipHull{
 		paintColour: boolGrid{},
 		visited:     boolGrid{},
 	}
 	robo := robot{}
-	output := make(chan int64)
-	input := make(chan int64, 1)
+	output := make(chan int)
+	input := make(chan int, 1)
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
@@ -154,9 +157,22 @@ func runPainter(program string, startingPanel int64) shipHull {
 	}()
 
 	input <- startingPanel
-	tape := newMachine(program, input, output)
-	tape.run()
+	tape := intcode.NewMachine(intcode.Channels(input, output))
+	if err := tape.LoadProgram(program); err != nil {
+		panic(err)
+	}
+	tape.Run(false)
+	close(output)
 
 	wg.Wait()
 	return hull
 }
+
+func loadInputString() string {
+	inputRaw, err := ioutil.ReadFile("input.txt")
+	if err != nil {
+		panic(err)
+	}
+	return string(inputRaw)
+
+}
@@ -63,35 +63,39 @@ func exploreAll(program string, start point) area {
 		},
 	}
 	type routeState struct {
-		nextStep      int
-		previousState []byte
-		lastPos       point
+		nextStep int
+		cpu      *intcode.Machine
+		lastPos  point
 	}
 
+	initial := intcode.NewMachine(intcode.M19(nil, nil), intcode.DenseMemory())
+	if err := initial.LoadProgram(program); err != nil {
+		panic(err)
+	}
 	routes := []routeState{
-		routeState{1, []byte{}, start},
-		routeState{2, []byte{}, start},
-		routeState{3, []byte{}, start},
-		routeState{4, []byte{}, start},
+		routeState{1, &initial, start},
+		routeState{2, &initial, start},
+		routeState{3, &initial, start},
+		routeState{4, &initial, start},
 	}
 
 	lastRegionLen := -1
 	for {
 		nextRoutes := []routeState{}
 		for _, route := range routes {
-			wall, _, state, lastPos := tryRoute(program, &region, []int{route.nextStep}, route.previousState, route.lastPos)
+			wall, _, cpu, lastPos := tryRouteFrom(route.cpu, &region, route.nextStep, route.lastPos)
 			if !wall {
 				if route.nextStep != 1 {
-					nextRoutes = append(nextRoutes, routeState{2, state, lastPos})
+					nextRoutes = append(nextRoutes, routeState{2, cpu, lastPos})
 				}
 				if route.nextStep != 2 {
-					nextRoutes = append(nextRoutes, routeState{1, state, lastPos})
+					nextRoutes = append(nextRoutes, routeState{1, cpu, lastPos})
 				}
 				if route.nextStep != 3 {
-					nextRoutes = append(nextRoutes, routeState{4, state, lastPos})
+					nextRoutes = append(nextRoutes, routeState{4, cpu, lastPos})
 				}
 				if route.nextStep != 4 {
-					nextRoutes = append(nextRoutes, routeState{3, state, lastPos})
+					nextRoutes = append(nextRoutes, routeState{3, cpu, lastPos})
 				}
 			}
 		}
@@ -182,6 +186,22 @@ func tryRoute(program string, region *area, inputs []int, previousState []byte,
 	return mapper.hitWall, mapper.foundOxygen, state, mapper.position
 }
 
+// tryRouteFrom moves the droid a single step from the state held by a machine, leaving that
+// machine untouched
+func tryRouteFrom(from *intcode.Machine, region *area, step int, start point) (bool, bool, *intcode.Machine, point) {
+	mapper := robot{
+		tiles:     region,
+		inputList: []int{step},
+		position:  start,
+	}
+	cpu := from.Clone(intcode.M19(mapper.guided, mapper.outputCallback))
+	mapper.cpu = &cpu
+
+	cpu.Run(true)
+
+	return mapper.hitWall, mapper.foundOxygen, &cpu, mapper.position
+}
+
 type tile int
 
 const (
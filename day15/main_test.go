@@ -14,6 +14,25 @@ func TestPart2Answer(t *testing.T) {
 	assert.Equal(t, 350, part2())
 }
 
+func TestExploreAllMatchesSaveRestore(t *testing.T) {
+	program := loadInputString()
+	assert.Equal(t, exploreAllSaveRestore(program, point{0, 0}), exploreAll(program, point{0, 0}))
+}
+
+func BenchmarkExploreAll(b *testing.B) {
+	program := loadInputString()
+	b.Run("SaveRestore", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			exploreAllSaveRestore(program, point{0, 0})
+		}
+	})
+	b.Run("Clone", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			exploreAll(program, point{0, 0})
+		}
+	})
+}
+
 func BenchmarkPart1(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		part1()
@@ -32,3 +51,58 @@ func ExampleMain() {
 	// Part 1: 252
 	// Part 2: 350
 }
+
+// exploreAllSaveRestore is exploreAll as it was before cloning, branching with Save and Restore
+func exploreAllSaveRestore(program string, start point) area {
+	region := area{
+		grid: grid{
+			point{0, 0}: tileEmpty,
+		},
+	}
+	type routeState struct {
+		nextStep      int
+		previousState []byte
+		lastPos       point
+	}
+
+	routes := []routeState{
+		routeState{1, []byte{}, start},
+		routeState{2, []byte{}, start},
+		routeState{3, []byte{}, start},
+		routeState{4, []byte{}, start},
+	}
+
+	lastRegionLen := -1
+	for {
+		nextRoutes := []routeState{}
+		for _, route := range routes {
+			wall, _, state, lastPos := tryRoute(program, &region, []int{route.nextStep}, route.previousState, route.lastPos)
+			if !wall {
+				if route.nextStep != 1 {
+					nextRoutes = append(nextRoutes, routeState{2, state, lastPos})
+				}
+				if route.nextStep != 2 {
+					nextRoutes = append(nextRoutes, routeState{1, state, lastPos})
+				}
+				if route.nextStep != 3 {
+					nextRoutes = append(nextRoutes, routeState{4, state, lastPos})
+				}
+				if route.nextStep != 4 {
+					nextRoutes = append(nextRoutes, routeState{3, state, lastPos})
+				}
+			}
+		}
+		if len(nextRoutes) == 0 {
+			break
+		}
+		routes = nextRoutes
+
+		newRegionLen := len(region.grid)
+		if lastRegionLen == newRegionLen {
+			break
+		}
+		lastRegionLen = newRegionLen
+	}
+
+	return region
+}
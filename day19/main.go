@@ -68,7 +68,7 @@ type point struct {
 func getPoint(program string, x, y int) int {
 	t := tractor{}
 	t.inputs = []int{x, y}
-	m := intcode.NewMachine(intcode.M19(t.inputHandler, nil))
+	m := intcode.NewMachine(intcode.M19(t.inputHandler, nil), intcode.DenseMemory())
 	m.LoadProgram(program)
 	m.Run(true)
 	return m.Register(intcode.M19RegisterOutput)
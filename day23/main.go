@@ -90,7 +90,7 @@ func newNetwork() *network {
 			sendBuffer:    []int{i},
 			receiveBuffer: []int{},
 		}
-		dev.machine = intcode.NewMachine(intcode.M19(dev.inputHandler, dev.outputHandler))
+		dev.machine = intcode.NewMachine(intcode.M19(dev.inputHandler, dev.outputHandler), intcode.DenseMemory())
 		err := dev.machine.LoadProgram(prog)
 		if err != nil {
 			panic(err)
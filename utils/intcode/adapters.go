@@ -0,0 +1,99 @@
+package intcode
+
+import (
+	"bufio"
+	"io"
+)
+
+// asciiMax is the largest output value treated as a character by the ASCII adapters
+const asciiMax = 127
+
+// Channels sets the behaviour of the machine to AoC 2019 rules, reading input from and writing
+// output to channels
+//
+// Closing the input channel halts the machine at its next input. Output is discarded if the
+// output channel is nil.
+func Channels(input <-chan int, output chan<- int) MachineOption {
+	return M19(ChannelInput(input), ChannelOutput(output))
+}
+
+// ChannelInput creates an input callback reading from a channel, halting once it is closed
+func ChannelInput(input <-chan int) InputCallback {
+	return func() (int, bool) {
+		value, ok := <-input
+		return value, !ok
+	}
+}
+
+// ChannelOutput creates an output callback sending to a channel
+func ChannelOutput(output chan<- int) OutputCallback {
+	return func(value int) {
+		if output != nil {
+			output <- value
+		}
+	}
+}
+
+// ASCII sets the behaviour of the machine to AoC 2019 rules, reading input characters from r and
+// writing output characters to w
+//
+// Output values which are not ASCII characters are passed to numeric instead, or discarded if
+// it is nil.
+func ASCII(r io.Reader, w io.Writer, numeric OutputCallback) MachineOption {
+	return M19(ReaderInput(r), WriterOutput(w, numeric))
+}
+
+// ReaderInput creates an input callback reading one byte at a time from r, halting at the end of
+// the input
+func ReaderInput(r io.Reader) InputCallback {
+	br := bufio.NewReader(r)
+	return func() (int, bool) {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, true
+		}
+		return int(b), false
+	}
+}
+
+// WriterOutput creates an output callback writing ASCII characters to w, and passing any other
+// values to numeric
+//
+// Write errors are discarded; use an ASCIIWriter to check for them.
+func WriterOutput(w io.Writer, numeric OutputCallback) OutputCallback {
+	return NewASCIIWriter(w, numeric).Output
+}
+
+// ASCIIWriter writes ASCII output characters to a writer, passing any other values to a numeric
+// callback
+//
+// The first error from the writer is recorded, and any later characters are discarded.
+type ASCIIWriter struct {
+	w       io.Writer
+	numeric OutputCallback
+	err     error
+}
+
+// NewASCIIWriter creates a writer of ASCII characters to w, passing any other values to numeric or
+// discarding them if it is nil
+func NewASCIIWriter(w io.Writer, numeric OutputCallback) *ASCIIWriter {
+	return &ASCIIWriter{w: w, numeric: numeric}
+}
+
+// Output is an OutputCallback writing a value
+func (a *ASCIIWriter) Output(value int) {
+	if value < 0 || value > asciiMax {
+		if a.numeric != nil {
+			a.numeric(value)
+		}
+		return
+	}
+	if a.w != nil && a.err == nil {
+		_, a.err = a.w.Write([]byte{byte(value)})
+	}
+}
+
+// Err reports the first error encountered while writing
+func (a *ASCIIWriter) Err() error {
+	return a.err
+}
@@ -0,0 +1,89 @@
+package intcode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const echoTestSource = `
+	       OUT  1000
+	loop:  INP  [value]
+	       OUT  [value]
+	       JNZ  1, loop
+	value: DATA 0
+`
+
+func TestChannels(t *testing.T) {
+	program, err := Assemble(echoTestSource)
+	assert.NoError(t, err)
+
+	input := make(chan int, 3)
+	output := make(chan int, 10)
+	m := NewMachine(Channels(input, output))
+	assert.NoError(t, m.LoadProgram(program))
+
+	input <- 5
+	input <- -6
+	close(input)
+	rc, err := m.TryRun(false)
+	assert.NoError(t, err)
+	assert.Equal(t, ExecRCHCF, rc)
+	close(output)
+
+	outputs := []int{}
+	for value := range output {
+		outputs = append(outputs, value)
+	}
+	assert.Equal(t, []int{1000, 5, -6}, outputs)
+}
+
+func TestASCII(t *testing.T) {
+	program, err := Assemble(echoTestSource)
+	assert.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	numeric := []int{}
+	m := NewMachine(ASCII(strings.NewReader("WALK\n"), out, func(value int) {
+		numeric = append(numeric, value)
+	}))
+	assert.NoError(t, m.LoadProgram(program))
+	m.Run(false)
+
+	assert.Equal(t, "WALK\n", out.String())
+	assert.Equal(t, []int{1000}, numeric)
+}
+
+// failingWriter accepts a number of bytes, then fails every write
+type failingWriter struct {
+	remaining int
+	written   []byte
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.remaining < len(p) {
+		return 0, errors.New("Closed pipe")
+	}
+	w.remaining -= len(p)
+	w.written = append(w.written, p...)
+	return len(p), nil
+}
+
+func TestASCIIWriter(t *testing.T) {
+	w := &failingWriter{remaining: 2}
+	numeric := []int{}
+	a := NewASCIIWriter(w, func(value int) { numeric = append(numeric, value) })
+	for _, value := range []int{'a', 'b', 1000, 'c', 'd'} {
+		a.Output(value)
+	}
+	assert.Equal(t, "ab", string(w.written))
+	assert.Equal(t, []int{1000}, numeric)
+	assert.EqualError(t, a.Err(), "Closed pipe")
+
+	w.remaining = 10
+	a.Output('e')
+	assert.Equal(t, "ab", string(w.written))
+}
@@ -0,0 +1,394 @@
+package intcode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Assemble converts intcode assembly into a program string suitable for Machine.LoadProgram
+//
+// Each line holds an optional label, an optional instruction and an optional comment:
+//
+//	loop:  ADD  [counter], 1, [counter]  ; increment the counter
+//	       JNZ  [counter], loop
+//	       HCF
+//	counter: DATA 0
+//
+// Mnemonics are those used by the M19 decoder (ADD, MUL, INP, OUT, JNZ, JEZ, CLT, CEQ, ARB, HCF).
+// Operands are written as:
+//
+//	5, label, label+1, 'A'   immediate value
+//	[5], [label+1]            positional (value at address)
+//	[rb], [rb+5], [rb-1]      relative to the relative base
+//
+// The DATA directive emits raw values, which may be numbers, labels, characters or quoted strings.
+// The ORG directive moves the address of the statements which follow forward, filling the gap
+// with zeros. Its operand may only refer to labels defined before it.
+func Assemble(source string) (string, error) {
+	values, err := assemble(source)
+	if err != nil {
+		return "", err
+	}
+	valueStrings := make([]string, len(values))
+	for i, value := range values {
+		valueStrings[i] = strconv.Itoa(value)
+	}
+	return strings.Join(valueStrings, ","), nil
+}
+
+// AssemblyError reports a problem with a line of assembly source
+type AssemblyError struct {
+	Line    int
+	Message string
+}
+
+func (e *AssemblyError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// asmMaxOrigin is the highest address accepted by ORG, as the program is filled with zeros up to it
+const asmMaxOrigin = 1 << 20
+
+type asmStatement struct {
+	line     int
+	address  address
+	mnemonic string
+	operands []string
+}
+
+func assemble(source string) ([]int, error) {
+	labels := map[string]address{}
+	statements := []asmStatement{}
+
+	pos := address(0)
+	for lineIdx, line := range strings.Split(source, "\n") {
+		lineNum := lineIdx + 1
+		line = stripAsmComment(line)
+		lineLabels := []string{}
+		for {
+			line = strings.TrimSpace(line)
+			colon := strings.Index(line, ":")
+			if colon < 0 || !isAsmIdentifier(line[:colon]) {
+				break
+			}
+			label := line[:colon]
+			if strings.EqualFold(label, "rb") {
+				return nil, &AssemblyError{lineNum, fmt.Sprintf("reserved label name %q", label)}
+			}
+			if _, found := labels[label]; found {
+				return nil, &AssemblyError{lineNum, fmt.Sprintf("duplicate label %q", label)}
+			}
+			labels[label] = pos
+			lineLabels = append(lineLabels, label)
+			line = line[colon+1:]
+		}
+		if line == "" {
+			continue
+		}
+
+		mnemonic, operandList := line, ""
+		if split := strings.IndexAny(line, " \t"); split >= 0 {
+			mnemonic, operandList = line[:split], strings.TrimSpace(line[split+1:])
+		}
+		stmt := asmStatement{
+			line:     lineNum,
+			address:  pos,
+			mnemonic: strings.ToUpper(mnemonic),
+		}
+		if operandList != "" {
+			operands, err := splitAsmOperands(operandList)
+			if err != nil {
+				return nil, &AssemblyError{lineNum, err.Error()}
+			}
+			stmt.operands = operands
+		}
+
+		if stmt.mnemonic == "ORG" {
+			if len(stmt.operands) != 1 {
+				return nil, &AssemblyError{lineNum, fmt.Sprintf("ORG takes 1 operand, got %d", len(stmt.operands))}
+			}
+			origin, err := evalAsmExpression(stmt.operands[0], labels)
+			switch {
+			case err != nil:
+				return nil, &AssemblyError{lineNum, err.Error()}
+			case origin < int(pos):
+				return nil, &AssemblyError{lineNum, fmt.Sprintf("origin %d is before address %d", origin, pos)}
+			case origin > asmMaxOrigin:
+				return nil, &AssemblyError{lineNum, fmt.Sprintf("origin %d is beyond the limit of %d", origin, asmMaxOrigin)}
+			}
+			pos = address(origin)
+			stmt.address = pos
+			for _, label := range lineLabels {
+				labels[label] = pos
+			}
+			statements = append(statements, stmt)
+			continue
+		}
+		if stmt.mnemonic == "DATA" {
+			size := 0
+			for _, operand := range stmt.operands {
+				if strings.HasPrefix(operand, "\"") {
+					str, err := strconv.Unquote(operand)
+					if err != nil {
+						return nil, &AssemblyError{lineNum, fmt.Sprintf("bad string %s", operand)}
+					}
+					size += len(str)
+				} else {
+					size++
+				}
+			}
+			pos += address(size)
+		} else {
+			def, found := M19Model.LookupName(stmt.mnemonic)
+			if !found {
+				return nil, &AssemblyError{lineNum, fmt.Sprintf("unknown mnemonic %q", mnemonic)}
+			}
+			if len(stmt.operands) != def.NumParams {
+				return nil, &AssemblyError{lineNum, fmt.Sprintf(
+					"%s takes %d operands, got %d", def.Name, def.NumParams, len(stmt.operands),
+				)}
+			}
+			pos += address(1 + def.NumParams)
+		}
+		statements = append(statements, stmt)
+	}
+
+	values := []int{}
+	for _, stmt := range statements {
+		if stmt.mnemonic == "ORG" {
+			for len(values) < int(stmt.address) {
+				values = append(values, 0)
+			}
+			continue
+		}
+		if stmt.mnemonic == "DATA" {
+			for _, operand := range stmt.operands {
+				if strings.HasPrefix(operand, "\"") {
+					str, _ := strconv.Unquote(operand)
+					for _, ch := range []byte(str) {
+						values = append(values, int(ch))
+					}
+					continue
+				}
+				value, err := evalAsmExpression(operand, labels)
+				if err != nil {
+					return nil, &AssemblyError{stmt.line, err.Error()}
+				}
+				values = append(values, value)
+			}
+			continue
+		}
+
+		def, _ := M19Model.LookupName(stmt.mnemonic)
+		instruction := def.Code
+		params := make([]int, def.NumParams)
+		modeMultiplier := 100
+		for i, operand := range stmt.operands {
+			mode, value, err := parseAsmOperand(operand, labels)
+			if err != nil {
+				return nil, &AssemblyError{stmt.line, fmt.Sprintf("operand %d: %v", i+1, err)}
+			}
+			if mode == ModeImmediate && i == def.WriteParam {
+				return nil, &AssemblyError{stmt.line, fmt.Sprintf(
+					"operand %d: %s cannot write to an immediate value", i+1, def.Name,
+				)}
+			}
+			instruction += int(mode) * modeMultiplier
+			modeMultiplier *= 10
+			params[i] = value
+		}
+		values = append(values, instruction)
+		values = append(values, params...)
+	}
+	return values, nil
+}
+
+func parseAsmOperand(operand string, labels map[string]address) (ParamMode, int, error) {
+	if !strings.HasPrefix(operand, "[") {
+		value, err := evalAsmExpression(operand, labels)
+		return ModeImmediate, value, err
+	}
+	if !strings.HasSuffix(operand, "]") {
+		return 0, 0, fmt.Errorf("unterminated address %q", operand)
+	}
+	inner := strings.TrimSpace(operand[1 : len(operand)-1])
+	if len(inner) >= 2 && strings.EqualFold(inner[:2], "rb") &&
+		(len(inner) == 2 || !isAsmIdentifierChar(inner[2])) {
+		offset := strings.TrimSpace(inner[2:])
+		if offset == "" {
+			return ModeRelative, 0, nil
+		}
+		if offset[0] != '+' && offset[0] != '-' {
+			return 0, 0, fmt.Errorf("bad relative offset %q", operand)
+		}
+		value, err := evalAsmExpression(offset, labels)
+		return ModeRelative, value, err
+	}
+	value, err := evalAsmExpression(inner, labels)
+	return ModePositional, value, err
+}
+
+// evalAsmExpression evaluates sums and differences of numbers, characters and labels
+func evalAsmExpression(expr string, labels map[string]address) (int, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return 0, fmt.Errorf("missing value")
+	}
+	total := 0
+	sign := 1
+	// operator holds the last operator read until the term following it is found
+	var operator byte
+	for pos := 0; pos < len(expr); {
+		switch ch := expr[pos]; {
+		case ch == ' ' || ch == '\t':
+			pos++
+			continue
+		case ch == '+' || ch == '-':
+			if ch == '-' {
+				sign = -sign
+			}
+			operator = ch
+			pos++
+			continue
+		}
+		operator = 0
+
+		end := pos + 1
+		var term int
+		switch ch := expr[pos]; {
+		case ch == '\'':
+			for end < len(expr) && expr[end] != '\'' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return 0, fmt.Errorf("unterminated character in %q", expr)
+			}
+			end++
+			char, _, _, err := strconv.UnquoteChar(expr[pos+1:end-1], '\'')
+			if err != nil {
+				return 0, fmt.Errorf("bad character %s", expr[pos:end])
+			}
+			term = int(char)
+		case ch >= '0' && ch <= '9':
+			for end < len(expr) && isAsmIdentifierChar(expr[end]) {
+				end++
+			}
+			base := 10
+			if strings.HasPrefix(expr[pos:end], "0x") {
+				base = 0
+			}
+			value, err := strconv.ParseInt(expr[pos:end], base, 0)
+			if err != nil {
+				return 0, fmt.Errorf("bad number %q", expr[pos:end])
+			}
+			term = int(value)
+		case isAsmIdentifierChar(ch):
+			for end < len(expr) && isAsmIdentifierChar(expr[end]) {
+				end++
+			}
+			label := expr[pos:end]
+			addr, found := labels[label]
+			if !found {
+				return 0, fmt.Errorf("undefined label %q", label)
+			}
+			term = int(addr)
+		default:
+			return 0, fmt.Errorf("unexpected %q in %q", ch, expr)
+		}
+		total += sign * term
+		sign = 1
+		pos = end
+
+		for pos < len(expr) && (expr[pos] == ' ' || expr[pos] == '\t') {
+			pos++
+		}
+		if pos < len(expr) && expr[pos] != '+' && expr[pos] != '-' {
+			return 0, fmt.Errorf("unexpected %q in %q", expr[pos], expr)
+		}
+	}
+	if operator != 0 {
+		return 0, fmt.Errorf("missing value after %q in %q", operator, expr)
+	}
+	return total, nil
+}
+
+// splitAsmOperands splits a comma separated operand list, respecting quotes
+func splitAsmOperands(list string) ([]string, error) {
+	operands := []string{}
+	current := ""
+	var quote byte
+	for i := 0; i < len(list); i++ {
+		ch := list[i]
+		switch {
+		case quote != 0:
+			current += string(ch)
+			if ch == '\\' && i+1 < len(list) {
+				i++
+				current += string(list[i])
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+			current += string(ch)
+		case ch == ',':
+			operands = append(operands, strings.TrimSpace(current))
+			current = ""
+		default:
+			current += string(ch)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", list)
+	}
+	operands = append(operands, strings.TrimSpace(current))
+	for _, operand := range operands {
+		if operand == "" {
+			return nil, fmt.Errorf("empty operand in %q", list)
+		}
+	}
+	return operands, nil
+}
+
+func stripAsmComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isAsmIdentifier(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isAsmIdentifierChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAsmIdentifierChar(ch byte) bool {
+	return ch == '_' || ch == '.' ||
+		(ch >= 'a' && ch <= 'z') ||
+		(ch >= 'A' && ch <= 'Z') ||
+		(ch >= '0' && ch <= '9')
+}
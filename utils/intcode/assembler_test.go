@@ -0,0 +1,183 @@
+package intcode
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssemble(t *testing.T) {
+	type testDef struct {
+		source  string
+		program string
+	}
+	tests := []testDef{
+		testDef{
+			source:  "ADD [0], [0], [0]\nHCF",
+			program: "1,0,0,0,99",
+		},
+		testDef{
+			source:  "MUL [4], 3, [4]\nDATA 33",
+			program: "1002,4,3,4,33",
+		},
+		testDef{
+			source:  "ARB 1\nOUT [rb-1] ; echo\nHCF",
+			program: "109,1,204,-1,99",
+		},
+		testDef{
+			source: `
+				; Compare input with 8
+				start:
+					INP  [value]
+					CEQ  [value], [target], [value]
+					OUT  [value]
+					HCF
+				value:  DATA -1
+				target: DATA 8
+			`,
+			program: "3,9,8,9,10,9,4,9,99,-1,8",
+		},
+		testDef{
+			source: `
+				loop: JNZ 1, loop
+				      JEZ [rb+2], end
+				end:  HCF
+			`,
+			program: "1105,1,0,1206,2,6,99",
+		},
+		testDef{
+			source:  `DATA "AB", 'C', '\n', end-1, 0x10 ; comment with "quotes"` + "\nend:",
+			program: "65,66,67,10,5,16",
+		},
+		testDef{
+			source:  "a: b: add [a], [b], [rb]",
+			program: "20001,0,0,0",
+		},
+		testDef{
+			source:  `DATA '\\', '\'', -1`,
+			program: "92,39,-1",
+		},
+		testDef{
+			source:  "JNZ 1, far\nnear: ORG 8\nfar: HCF\nDATA near",
+			program: "1105,1,8,0,0,0,0,0,99,8",
+		},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			program, err := Assemble(test.source)
+			assert.NoError(t, err)
+			assert.Equal(t, test.program, program)
+		})
+	}
+}
+
+func TestAssembleRuns(t *testing.T) {
+	source := `
+		; Output 10 down to 1
+		loop:  OUT  [counter]
+		       ADD  [counter], -1, [counter]
+		       JNZ  [counter], loop
+		       HCF
+		counter: DATA 10
+	`
+	program, err := Assemble(source)
+	assert.NoError(t, err)
+
+	outputs := []int{}
+	m := NewMachine(M19(nil, func(out int) { outputs = append(outputs, out) }))
+	assert.NoError(t, m.LoadProgram(program))
+	m.Run(false)
+	assert.Equal(t, []int{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, outputs)
+}
+
+func TestAssembleErrors(t *testing.T) {
+	type testDef struct {
+		source string
+		line   int
+		error  string
+	}
+	tests := []testDef{
+		testDef{
+			source: "HCF\nFOO 1",
+			line:   2,
+			error:  `line 2: unknown mnemonic "FOO"`,
+		},
+		testDef{
+			source: "ADD 1, 2",
+			line:   1,
+			error:  "line 1: ADD takes 3 operands, got 2",
+		},
+		testDef{
+			source: "\n\nADD 1, 2, 3",
+			line:   3,
+			error:  "line 3: operand 3: ADD cannot write to an immediate value",
+		},
+		testDef{
+			source: "JNZ 1, nowhere",
+			line:   1,
+			error:  `line 1: operand 2: undefined label "nowhere"`,
+		},
+		testDef{
+			source: "OUT [rb*2]",
+			line:   1,
+			error:  `line 1: operand 1: bad relative offset "[rb*2]"`,
+		},
+		testDef{
+			source: "OUT [5",
+			line:   1,
+			error:  `line 1: operand 1: unterminated address "[5"`,
+		},
+		testDef{
+			source: "x: HCF\nx: HCF",
+			line:   2,
+			error:  `line 2: duplicate label "x"`,
+		},
+		testDef{
+			source: "DATA 1,,2",
+			line:   1,
+			error:  `line 1: empty operand in "1,,2"`,
+		},
+		testDef{
+			source: "DATA 5+",
+			line:   1,
+			error:  `line 1: missing value after '+' in "5+"`,
+		},
+		testDef{
+			source: "OUT [rb+]",
+			line:   1,
+			error:  `line 1: operand 1: missing value after '+' in "+"`,
+		},
+		testDef{
+			source: "DATA -",
+			line:   1,
+			error:  `line 1: missing value after '-' in "-"`,
+		},
+		testDef{
+			source: `DATA '\'`,
+			line:   1,
+			error:  `line 1: unterminated quote in "'\\'"`,
+		},
+		testDef{
+			source: "HCF\nORG 0",
+			line:   2,
+			error:  "line 2: origin 0 is before address 1",
+		},
+		testDef{
+			source: "ORG 0x100001",
+			line:   1,
+			error:  "line 1: origin 1048577 is beyond the limit of 1048576",
+		},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			_, err := Assemble(test.source)
+			if assert.Error(t, err) {
+				assert.Equal(t, test.error, err.Error())
+				if asmErr, ok := err.(*AssemblyError); assert.True(t, ok) {
+					assert.Equal(t, test.line, asmErr.Line)
+				}
+			}
+		})
+	}
+}
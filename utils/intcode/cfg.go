@@ -0,0 +1,405 @@
+package intcode
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ControlFlowGraph is a static analysis of the basic blocks, subroutines and data accesses of a
+// program
+//
+// Subroutines are recognised by the calling convention of compiled intcode: an unconditional jump
+// to an instruction which increases the relative base is a call, which returns to the address
+// most recently stored to a relative parameter by an ADD or MUL of two immediate values. Jumps to
+// addresses held in memory are only followed when they return from a subroutine.
+type ControlFlowGraph struct {
+	// Blocks lists the basic blocks in address order
+	Blocks []*BasicBlock
+	// Subroutines lists the subroutines called, in address order
+	Subroutines []*Subroutine
+	// Data records the addresses accessed through positional parameters, as WatchRead and
+	// WatchWrite flags
+	Data map[int]WatchKind
+
+	code *Disassembly
+}
+
+// BasicBlock is a run of instructions which is only entered at its start and only left at its end
+type BasicBlock struct {
+	// Start is the address of the first instruction, and End the address after the last
+	Start, End   int
+	Instructions []int
+	Successors   []Edge
+	// Predecessors lists the starts of blocks with an edge to this one
+	Predecessors []int
+	// Subroutine is the entry of the subroutine containing the block, or -1 outside any subroutine
+	Subroutine int
+	// Reads and Writes list the addresses accessed by the block through positional parameters
+	Reads, Writes []int
+}
+
+// EdgeKind describes how control passes between two blocks
+type EdgeKind int
+
+const (
+	// EdgeFallthrough continues to the next instruction
+	EdgeFallthrough EdgeKind = iota
+	// EdgeJump is a jump taken to an immediate address
+	EdgeJump
+	// EdgeCall enters a subroutine
+	EdgeCall
+	// EdgeCallReturn links a call to the address its subroutine returns to
+	EdgeCallReturn
+	// EdgeReturn leaves a subroutine for an address it was called from
+	EdgeReturn
+)
+
+func (k EdgeKind) String() string {
+	switch k {
+	case EdgeFallthrough:
+		return "fallthrough"
+	case EdgeJump:
+		return "jump"
+	case EdgeCall:
+		return "call"
+	case EdgeCallReturn:
+		return "call-return"
+	case EdgeReturn:
+		return "return"
+	}
+	return fmt.Sprintf("EdgeKind(%d)", int(k))
+}
+
+// Edge is a transfer of control to the block starting at Target
+type Edge struct {
+	Target int
+	Kind   EdgeKind
+}
+
+// Subroutine is a region of code entered by calls
+type Subroutine struct {
+	Entry int
+	// Frame is the amount the relative base is increased by on entry
+	Frame int
+	// Blocks lists the starts of the blocks reachable from the entry without making further calls
+	Blocks []int
+	// CallSites lists the addresses of the jumps which call the subroutine
+	CallSites []int
+	// ReturnSites lists the addresses the subroutine returns to
+	ReturnSites []int
+}
+
+// ControlFlow analyses a program, following control flow from address 0 and any extra entry points
+func ControlFlow(program string, entryPoints ...int) (*ControlFlowGraph, error) {
+	values, err := parseProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	return controlFlow(newMemoryImage(values), entryPoints), nil
+}
+
+// ControlFlow analyses the current contents of the machine's RAM, following control flow from
+// address 0, the current instruction pointer and any extra entry points
+func (m *Machine) ControlFlow(entryPoints ...int) *ControlFlowGraph {
+	entryPoints = append(entryPoints, m.Register(RegisterInstructionPointer))
+	return controlFlow(m.ramImage(), entryPoints)
+}
+
+// controlFlowOp is a decoded instruction with the edges leaving it, if it ends a block
+type controlFlowOp struct {
+	disassembledOp
+	size     int
+	endBlock bool
+	edges    []Edge
+	indirect bool
+}
+
+func controlFlow(img memoryImage, entryPoints []int) *ControlFlowGraph {
+	ops := map[int]*controlFlowOp{}
+	isCode := map[int]bool{}
+	leaders := map[int]bool{}
+	frames := map[int]int{}
+	callSites := map[int][]int{}
+	returnSites := map[int][]int{}
+
+	decode := func(addr int) (*controlFlowOp, bool) {
+		def, modes, valid := decodeM19(img.value(addr))
+		if !valid || !isCanonicalM19(img.value(addr), def, modes) {
+			return nil, false
+		}
+		if _, found := img.run(addr, 1+def.NumParams); !found {
+			return nil, false
+		}
+		for pos := addr; pos <= addr+def.NumParams; pos++ {
+			if isCode[pos] {
+				return nil, false
+			}
+		}
+		return &controlFlowOp{
+			disassembledOp: disassembledOp{img.value(addr) % 100, def, modes},
+			size:           1 + def.NumParams,
+		}, true
+	}
+
+	work := append([]int{0}, entryPoints...)
+	for _, entry := range work {
+		leaders[entry] = true
+	}
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+		returnSite := -1
+
+	flow:
+		for img.contains(addr) {
+			if _, found := ops[addr]; found {
+				break
+			}
+			op, valid := decode(addr)
+			if !valid {
+				break
+			}
+			for pos := addr; pos < addr+op.size; pos++ {
+				isCode[pos] = true
+			}
+			ops[addr] = op
+			values, _ := img.run(addr, op.size)
+			params := values[1:]
+
+			switch op.code {
+			case m19OpHCF:
+				op.endBlock = true
+				break flow
+			case m19OpAdd, m19OpMultiply:
+				if op.modes[0] == ModeImmediate && op.modes[1] == ModeImmediate && op.modes[2] == ModeRelative {
+					returnSite = params[0] + params[1]
+					if op.code == m19OpMultiply {
+						returnSite = params[0] * params[1]
+					}
+				}
+			case m19OpJumpTrue, m19OpJumpFalse:
+				op.endBlock = true
+				taken, notTaken := true, true
+				if op.modes[0] == ModeImmediate {
+					taken = (op.code == m19OpJumpTrue) == (params[0] != 0)
+					notTaken = !taken
+				}
+				switch {
+				case !taken:
+				case op.modes[1] != ModeImmediate:
+					op.indirect = true
+				case notTaken || callFrame(img, params[1]) <= 0:
+					op.edges = append(op.edges, Edge{params[1], EdgeJump})
+					leaders[params[1]] = true
+					work = append(work, params[1])
+				default:
+					target := params[1]
+					op.edges = append(op.edges, Edge{target, EdgeCall})
+					leaders[target] = true
+					work = append(work, target)
+					frames[target] = callFrame(img, target)
+					callSites[target] = append(callSites[target], addr)
+					if img.contains(returnSite) {
+						op.edges = append(op.edges, Edge{returnSite, EdgeCallReturn})
+						leaders[returnSite] = true
+						work = append(work, returnSite)
+						returnSites[target] = append(returnSites[target], returnSite)
+					}
+				}
+				if !notTaken {
+					break flow
+				}
+				op.edges = append(op.edges, Edge{addr + op.size, EdgeFallthrough})
+				leaders[addr+op.size] = true
+			}
+			addr += op.size
+		}
+	}
+
+	g := &ControlFlowGraph{Data: map[int]WatchKind{}}
+	addrs := make([]int, 0, len(ops))
+	for addr := range ops {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+	g.code = disassemble(img, addrs, decodeM19)
+
+	var block *BasicBlock
+	blocks := map[int]*BasicBlock{}
+	for _, addr := range addrs {
+		op := ops[addr]
+		if block == nil || leaders[addr] || block.End != addr {
+			if block != nil && block.End == addr {
+				block.Successors = append(block.Successors, Edge{addr, EdgeFallthrough})
+			}
+			block = &BasicBlock{Start: addr, End: addr, Subroutine: -1}
+			g.Blocks = append(g.Blocks, block)
+			blocks[addr] = block
+		}
+		block.Instructions = append(block.Instructions, addr)
+		block.End += op.size
+		for i, mode := range op.modes {
+			if mode != ModePositional {
+				continue
+			}
+			target := img.value(addr + 1 + i)
+			if i == op.def.WriteParam {
+				g.Data[target] |= WatchWrite
+				block.Writes = appendUnique(block.Writes, target)
+			} else {
+				g.Data[target] |= WatchRead
+				block.Reads = appendUnique(block.Reads, target)
+			}
+		}
+		if op.endBlock {
+			block.Successors = append(block.Successors, op.edges...)
+			block = nil
+		}
+	}
+
+	entries := make([]int, 0, len(frames))
+	for entry := range frames {
+		entries = append(entries, entry)
+	}
+	sort.Ints(entries)
+	for _, entry := range entries {
+		sub := &Subroutine{
+			Entry:       entry,
+			Frame:       frames[entry],
+			CallSites:   sortedUnique(callSites[entry]),
+			ReturnSites: sortedUnique(returnSites[entry]),
+		}
+		g.Subroutines = append(g.Subroutines, sub)
+		seen := map[int]bool{entry: true}
+		pending := []int{entry}
+		for len(pending) > 0 {
+			current := blocks[pending[len(pending)-1]]
+			pending = pending[:len(pending)-1]
+			if current == nil {
+				continue
+			}
+			sub.Blocks = append(sub.Blocks, current.Start)
+			if current.Subroutine < 0 {
+				current.Subroutine = entry
+			}
+			last := ops[current.Instructions[len(current.Instructions)-1]]
+			if last.indirect {
+				for _, site := range sub.ReturnSites {
+					current.Successors = append(current.Successors, Edge{site, EdgeReturn})
+				}
+			}
+			for _, edge := range current.Successors {
+				if edge.Kind != EdgeCall && edge.Kind != EdgeReturn && !seen[edge.Target] {
+					seen[edge.Target] = true
+					pending = append(pending, edge.Target)
+				}
+			}
+		}
+		sort.Ints(sub.Blocks)
+	}
+
+	for _, from := range g.Blocks {
+		for _, edge := range from.Successors {
+			if to, found := blocks[edge.Target]; found {
+				to.Predecessors = appendUnique(to.Predecessors, from.Start)
+			}
+		}
+	}
+	for _, to := range g.Blocks {
+		sort.Ints(to.Predecessors)
+		sort.Ints(to.Reads)
+		sort.Ints(to.Writes)
+	}
+	return g
+}
+
+// callFrame returns the relative base increase made by the instruction at target, or 0 if it is
+// not an ARB with a positive immediate parameter
+func callFrame(img memoryImage, target int) int {
+	values, found := img.run(target, 2)
+	if !found || values[0] != 100+m19OpAdjustRelativeBase {
+		return 0
+	}
+	if frame := values[1]; frame > 0 {
+		return frame
+	}
+	return 0
+}
+
+func appendUnique(values []int, value int) []int {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func sortedUnique(values []int) []int {
+	unique := []int{}
+	for _, value := range values {
+		unique = appendUnique(unique, value)
+	}
+	sort.Ints(unique)
+	return unique
+}
+
+// Block finds the block containing the instruction at addr
+func (g *ControlFlowGraph) Block(addr int) (*BasicBlock, bool) {
+	i := sort.Search(len(g.Blocks), func(i int) bool { return g.Blocks[i].End > addr })
+	if i < len(g.Blocks) && g.Blocks[i].Start <= addr {
+		return g.Blocks[i], true
+	}
+	return nil, false
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// WriteDOT writes the graph in the Graphviz DOT language, with each subroutine drawn as a cluster
+func (g *ControlFlowGraph) WriteDOT(w io.Writer) error {
+	lines := []string{
+		"digraph intcode {",
+		"\tnode [shape=box, fontname=\"monospace\"];",
+	}
+	for _, sub := range g.Subroutines {
+		lines = append(lines, fmt.Sprintf("\tsubgraph cluster_%s {", functionName(address(sub.Entry))))
+		lines = append(lines, fmt.Sprintf("\t\tlabel=\"%s\";", functionName(address(sub.Entry))))
+		for _, start := range sub.Blocks {
+			if block, _ := g.Block(start); block.Subroutine == sub.Entry {
+				lines = append(lines, fmt.Sprintf("\t\tb%d;", start))
+			}
+		}
+		lines = append(lines, "\t}")
+	}
+	for _, block := range g.Blocks {
+		text := ""
+		for _, addr := range block.Instructions {
+			line, _ := g.code.lineAt(addr)
+			if line.Label != "" && addr == block.Start {
+				text += line.Label + ":\\l"
+			}
+			instruction := fmt.Sprintf("%v  %-5s%s", address(addr), line.Mnemonic, strings.Join(line.Operands, ", "))
+			text += dotEscaper.Replace(strings.TrimSpace(instruction))
+			text += "\\l"
+		}
+		lines = append(lines, fmt.Sprintf("\tb%d [label=\"%s\"];", block.Start, text))
+	}
+	for _, block := range g.Blocks {
+		for _, edge := range block.Successors {
+			lines = append(lines, fmt.Sprintf("\tb%d -> b%d%s;", block.Start, edge.Target, dotEdgeStyle[edge.Kind]))
+		}
+	}
+	lines = append(lines, "}")
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+var dotEdgeStyle = map[EdgeKind]string{
+	EdgeFallthrough: "",
+	EdgeJump:        " [color=blue]",
+	EdgeCall:        " [color=darkgreen, style=bold, label=\"call\"]",
+	EdgeCallReturn:  " [style=dashed]",
+	EdgeReturn:      " [color=red, style=dotted, label=\"return\"]",
+}
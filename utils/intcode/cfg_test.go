@@ -0,0 +1,98 @@
+package intcode
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const cfgTestSource = `
+	        ARB  stack
+	        ADD  ret1, 0, [rb]
+	        JNZ  1, count
+	ret1:   JEZ  [calls], done
+	        OUT  [calls]
+	done:   HCF
+	count:  ARB  2
+	        ADD  [calls], 1, [calls]
+	        ARB  -2
+	        JNZ  1, [rb]
+	calls:  DATA 0
+	stack:  DATA 0
+`
+
+func TestControlFlow(t *testing.T) {
+	program, err := Assemble(cfgTestSource)
+	assert.NoError(t, err)
+	g, err := ControlFlow(program)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []*BasicBlock{
+		{
+			Start: 0, End: 9, Instructions: []int{0, 2, 6},
+			Successors: []Edge{{15, EdgeCall}, {9, EdgeCallReturn}},
+			Subroutine: -1,
+		},
+		{
+			Start: 9, End: 12, Instructions: []int{9},
+			Successors:   []Edge{{14, EdgeJump}, {12, EdgeFallthrough}},
+			Predecessors: []int{0, 15},
+			Subroutine:   -1,
+			Reads:        []int{26},
+		},
+		{
+			Start: 12, End: 14, Instructions: []int{12},
+			Successors:   []Edge{{14, EdgeFallthrough}},
+			Predecessors: []int{9},
+			Subroutine:   -1,
+			Reads:        []int{26},
+		},
+		{
+			Start: 14, End: 15, Instructions: []int{14},
+			Predecessors: []int{9, 12},
+			Subroutine:   -1,
+		},
+		{
+			Start: 15, End: 26, Instructions: []int{15, 17, 21, 23},
+			Successors:   []Edge{{9, EdgeReturn}},
+			Predecessors: []int{0},
+			Subroutine:   15,
+			Reads:        []int{26},
+			Writes:       []int{26},
+		},
+	}, g.Blocks)
+	assert.Equal(t, []*Subroutine{
+		{Entry: 15, Frame: 2, Blocks: []int{15}, CallSites: []int{6}, ReturnSites: []int{9}},
+	}, g.Subroutines)
+	assert.Equal(t, map[int]WatchKind{26: WatchAccess}, g.Data)
+
+	block, found := g.Block(22)
+	assert.True(t, found)
+	assert.Equal(t, 15, block.Start)
+	_, found = g.Block(26)
+	assert.False(t, found)
+
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram(program))
+	assert.Equal(t, g.Blocks, m.ControlFlow().Blocks)
+
+	dot := &bytes.Buffer{}
+	assert.NoError(t, g.WriteDOT(dot))
+	assert.Contains(t, dot.String(), "\tsubgraph cluster_L0015 {\n\t\tlabel=\"L0015\";\n\t\tb15;\n\t}\n")
+	assert.Contains(t, dot.String(), "\tb9 [label=\"#0009  JEZ  [D0026], L0014\\l\"];\n")
+	assert.Contains(t, dot.String(), "\tb14 [label=\"L0014:\\l#0014  HCF\\l\"];\n")
+	assert.Contains(t, dot.String(), "\tb0 -> b15 [color=darkgreen, style=bold, label=\"call\"];\n")
+	assert.Contains(t, dot.String(), "\tb15 -> b9 [color=red, style=dotted, label=\"return\"];\n")
+}
+
+func TestControlFlowFarAddress(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,1,1,1099511627776,1105,1,11,0,0,0,0,99"))
+	m.WriteRAM(80, 7)
+	m.Run(false)
+
+	g := m.ControlFlow()
+	assert.Equal(t, []int{0, 11}, []int{g.Blocks[0].Start, g.Blocks[1].Start})
+	assert.Equal(t, []int{1099511627776}, g.Blocks[0].Writes)
+}
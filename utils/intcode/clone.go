@@ -0,0 +1,40 @@
+package intcode
+
+// Clone creates an independent copy of the machine, then applies any options to the copy
+//
+// Options such as M19 may be used to attach new input and output callbacks. With DenseMemory the
+// copies share memory pages until either writes to them, making clones cheap to create. Hooks
+// such as Trace, History and debuggers are not copied, and nor are attached devices.
+func (m *Machine) Clone(options ...MachineOption) Machine {
+	c := Machine{&machineState{
+		ram:              m.ram.clone(),
+		operations:       operationMap{},
+		registers:        registerList{},
+		inputQueue:       append([]int{}, m.inputQueue...),
+		instructionCount: m.instructionCount,
+		panicOnError:     m.panicOnError,
+		overflow:         m.overflow,
+		bigOutput:        m.bigOutput,
+		selfModify:       m.selfModify,
+		codeWrites:       append([]CodeWrite{}, m.codeWrites...),
+	}}
+	for addr, instruction := range m.executed {
+		if c.executed == nil {
+			c.executed = make(map[address]address, len(m.executed))
+		}
+		c.executed[addr] = instruction
+	}
+	for addr, value := range m.bigValues {
+		c.setBig(addr, value)
+	}
+	for reg, value := range m.registers {
+		c.registers[reg] = value
+	}
+	if m.model != nil {
+		c.model = m.model.clone(&c)
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
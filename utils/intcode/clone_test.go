@@ -0,0 +1,80 @@
+package intcode
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	engines := map[string]MachineOption{
+		"Sparse": func(*Machine) {},
+		"Dense":  DenseMemory(),
+	}
+	for name, engine := range engines {
+		t.Run(name, func(t *testing.T) {
+			outputs := []int{}
+			m := NewMachine(M19(nil, func(out int) { outputs = append(outputs, out) }), engine)
+			assert.NoError(t, m.LoadProgram("109,1,204,-1,1001,100,1,100,1008,100,16,101,1006,101,0,99"))
+			for i := 0; i < 20; i++ {
+				m.Step()
+			}
+			before := fmt.Sprintf("%v|%v", m.registers, m.ram)
+
+			cloneOutputs := []int{}
+			c := m.Clone(M19(nil, func(out int) { cloneOutputs = append(cloneOutputs, out) }))
+			assert.Equal(t, before, fmt.Sprintf("%v|%v", c.registers, c.ram))
+			assert.Equal(t, m.InstructionCount(), c.InstructionCount())
+
+			c.Run(false)
+			assert.Equal(t, before, fmt.Sprintf("%v|%v", m.registers, m.ram))
+			c.WriteRAM(0, 1)
+			assert.Equal(t, 109, m.ReadRAM(0))
+
+			m.Run(false)
+			assert.Equal(t, outputs[len(outputs)-len(cloneOutputs):], cloneOutputs)
+			assert.Equal(t, []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}, outputs)
+			assert.Equal(t, 1, c.ReadRAM(0))
+		})
+	}
+}
+
+func TestCloneSharesPages(t *testing.T) {
+	m := NewMachine(M19(nil, nil), DenseMemory())
+	assert.NoError(t, m.LoadProgram("1101,1,1,3000,99"))
+	m.WriteRAM(2000, 7)
+
+	c := m.Clone()
+	mem, cloneMem := m.ram.(*denseMemory), c.ram.(*denseMemory)
+	assert.True(t, mem.pages[0] == cloneMem.pages[0])
+	assert.True(t, mem.pages[1] == cloneMem.pages[1])
+
+	// Writing to new pages leaves the shared pages alone
+	c.Run(false)
+	assert.True(t, mem.pages[0] == cloneMem.pages[0])
+	assert.True(t, mem.pages[1] == cloneMem.pages[1])
+	assert.Len(t, mem.pages, 2)
+	assert.Len(t, cloneMem.pages, 3)
+	assert.Equal(t, 2, c.ReadRAM(3000))
+	assert.Equal(t, 0, m.ReadRAM(3000))
+
+	// Only the page written is copied
+	m.WriteRAM(0, 99)
+	assert.False(t, mem.pages[0] == cloneMem.pages[0])
+	assert.True(t, mem.pages[1] == cloneMem.pages[1])
+	assert.Equal(t, 1101, c.ReadRAM(0))
+}
+
+func BenchmarkClone(b *testing.B) {
+	program := loadTestProgram(b, "day15")
+	benchmarkEngines(b, func(b *testing.B, engine MachineOption) {
+		m := NewMachine(M19(nil, nil), engine)
+		m.LoadProgram(program)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			c := m.Clone()
+			c.WriteRAM(1000, i)
+		}
+	})
+}
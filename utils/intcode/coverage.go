@@ -0,0 +1,290 @@
+package intcode
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Coverage records which instructions of a program are executed, across any number of machines
+// running it
+//
+// Attach machines after loading the program and before running them. Attached machines may run
+// concurrently.
+type Coverage struct {
+	mu      sync.Mutex
+	program *memoryImage
+	hits    map[address]int
+	// hooks is keyed by machine state, as copies of a Machine share it
+	hooks map[*machineState]*coverageHook
+}
+
+// CoverageRange is a run of instructions which were never executed, from Start to End inclusive
+type CoverageRange struct {
+	Start, End int
+}
+
+func (r CoverageRange) String() string {
+	if r.Start == r.End {
+		return address(r.Start).String()
+	}
+	return fmt.Sprintf("%v-%v", address(r.Start), address(r.End))
+}
+
+// coverageHook records the instructions completed by one machine
+type coverageHook struct {
+	nopHook
+	coverage *Coverage
+	ip       address
+	op       operation
+}
+
+func (h *coverageHook) beforeStep(ip address, op operation) {
+	h.ip = ip
+	h.op = op
+}
+
+func (h *coverageHook) afterStep(rc ExecReturnCode) {
+	if h.op == nil || rc == ExecRCInvalidInstruction || rc == ExecRCNeedInput {
+		return
+	}
+	h.coverage.mu.Lock()
+	h.coverage.hits[h.ip]++
+	h.coverage.mu.Unlock()
+}
+
+// NewCoverage creates an empty coverage record
+func NewCoverage() *Coverage {
+	return &Coverage{
+		hits:  map[address]int{},
+		hooks: map[*machineState]*coverageHook{},
+	}
+}
+
+// Attach starts recording the instructions executed by a machine
+//
+// The first machine attached sets the program being covered, and later machines must hold the
+// same program.
+func (c *Coverage) Attach(m *Machine) error {
+	program := m.ramImage()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.program == nil {
+		c.program = &program
+	} else if !c.program.equal(program) {
+		return fmt.Errorf("Cannot attach coverage: machine holds a different program")
+	}
+	if _, found := c.hooks[m.machineState]; found {
+		return nil
+	}
+	hook := &coverageHook{coverage: c}
+	c.hooks[m.machineState] = hook
+	m.addHook(hook)
+	return nil
+}
+
+// Detach stops recording the instructions executed by a machine
+func (c *Coverage) Detach(m *Machine) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hook, found := c.hooks[m.machineState]; found {
+		m.removeHook(hook)
+		delete(c.hooks, m.machineState)
+	}
+}
+
+// Merge adds the hits recorded by another coverage record of the same program
+func (c *Coverage) Merge(other *Coverage) error {
+	other.mu.Lock()
+	program := other.program
+	hits := make(map[address]int, len(other.hits))
+	for addr, count := range other.hits {
+		hits[addr] = count
+	}
+	other.mu.Unlock()
+	if program == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.program == nil {
+		c.program = program
+	} else if !c.program.equal(*program) {
+		return fmt.Errorf("Cannot merge coverage: programs differ")
+	}
+	for addr, count := range hits {
+		c.hits[addr] += count
+	}
+	return nil
+}
+
+// Hits returns the number of times each executed address was executed
+func (c *Coverage) Hits() map[int]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hits := make(map[int]int, len(c.hits))
+	for addr, count := range c.hits {
+		hits[int(addr)] = count
+	}
+	return hits
+}
+
+// coverageLine is a line of the program's disassembly with its hit count
+type coverageLine struct {
+	DisassemblyLine
+	Hits int
+}
+
+// Class names the state of the line, as used by the HTML report
+func (line coverageLine) Class() string {
+	switch {
+	case !line.Code:
+		return "data"
+	case line.Hits == 0:
+		return "uncovered"
+	}
+	return "covered"
+}
+
+// Count renders the hit count, or a marker for uncovered instructions
+func (line coverageLine) Count() string {
+	switch {
+	case !line.Code:
+		return ""
+	case line.Hits == 0:
+		return "-"
+	}
+	return fmt.Sprintf("%d", line.Hits)
+}
+
+// Text renders the line as assembler source
+func (line coverageLine) Text() string {
+	return line.text()
+}
+
+// coverageReport is the annotated disassembly of the covered program
+type coverageReport struct {
+	Lines     []coverageLine
+	Covered   int
+	Total     int
+	Uncovered []CoverageRange
+}
+
+// Percent returns the proportion of instructions covered
+func (r *coverageReport) Percent() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(r.Covered) * 100 / float64(r.Total)
+}
+
+// report disassembles the program, following control flow from address 0 and every executed
+// address, and annotates it with hit counts
+func (c *Coverage) report() *coverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entryPoints := make([]int, 0, len(c.hits))
+	for addr := range c.hits {
+		entryPoints = append(entryPoints, int(addr))
+	}
+	sort.Ints(entryPoints)
+	program := memoryImage{}
+	if c.program != nil {
+		program = *c.program
+	}
+	code := disassemble(program, entryPoints, decodeM19)
+
+	r := &coverageReport{}
+	extend := false
+	for _, line := range code.Lines {
+		covered := coverageLine{line, c.hits[address(line.Address)]}
+		r.Lines = append(r.Lines, covered)
+		if !line.Code {
+			extend = false
+			continue
+		}
+		r.Total++
+		if covered.Hits > 0 {
+			r.Covered++
+			extend = false
+			continue
+		}
+		end := line.Address + len(line.Values) - 1
+		if extend {
+			r.Uncovered[len(r.Uncovered)-1].End = end
+		} else {
+			r.Uncovered = append(r.Uncovered, CoverageRange{line.Address, end})
+		}
+		extend = true
+	}
+	return r
+}
+
+// Summary returns the number of instructions executed and the number decoded
+func (c *Coverage) Summary() (covered, total int) {
+	r := c.report()
+	return r.Covered, r.Total
+}
+
+// Uncovered lists the runs of decoded instructions which were never executed
+func (c *Coverage) Uncovered() []CoverageRange {
+	return c.report().Uncovered
+}
+
+// Report writes the disassembly of the program, with the number of times each instruction was
+// executed, followed by the uncovered regions
+func (c *Coverage) Report(w io.Writer) error {
+	r := c.report()
+	lines := []string{fmt.Sprintf("Coverage: %d of %d instructions (%.2f%%)", r.Covered, r.Total, r.Percent()), ""}
+	for _, line := range r.Lines {
+		lines = append(lines, fmt.Sprintf("%10s  %s", line.Count(), line.Text()))
+	}
+	if len(r.Uncovered) > 0 {
+		lines = append(lines, "", "Uncovered:")
+		for _, uncovered := range r.Uncovered {
+			lines = append(lines, "\t"+uncovered.String())
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+var coverageHTML = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Intcode coverage</title>
+<style>
+body { font-family: monospace; }
+pre { line-height: 1.3; }
+.hits { display: inline-block; width: 8em; text-align: right; margin-right: 2em; color: #666; }
+.covered { background: #d7f5d7; }
+.uncovered { background: #f9d4d4; }
+.data { color: #888; }
+</style>
+</head>
+<body>
+<p>Coverage: {{.Covered}} of {{.Total}} instructions ({{printf "%.2f" .Percent}}%)</p>
+<pre>{{range .Lines}}<span class="{{.Class}}" id="a{{.Address}}"><span class="hits">{{.Count}}</span>{{.Text}}</span>
+{{end}}</pre>
+{{- if .Uncovered}}
+<h2>Uncovered</h2>
+<ul>
+{{- range .Uncovered}}
+<li><a href="#a{{.Start}}">{{.}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the annotated disassembly as an HTML page, highlighting covered and uncovered
+// instructions
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	return coverageHTML.Execute(w, c.report())
+}
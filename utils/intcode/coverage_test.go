@@ -0,0 +1,101 @@
+package intcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const coverageTestSource = `
+	        INP  [flag]
+	        JEZ  [flag], skip
+	        OUT  1
+	skip:   OUT  2
+	        HCF
+	flag:   DATA 0
+`
+
+func TestCoverage(t *testing.T) {
+	program, err := Assemble(coverageTestSource)
+	assert.NoError(t, err)
+	run := func(c *Coverage, flag int) {
+		m := NewMachine(M19(nil, nil))
+		assert.NoError(t, m.LoadProgram(program))
+		assert.NoError(t, c.Attach(&m))
+		m.QueueInput(flag)
+		m.Run(false)
+	}
+
+	skipped := NewCoverage()
+	run(skipped, 0)
+	run(skipped, 0)
+	assert.Equal(t, map[int]int{0: 2, 2: 2, 7: 2, 9: 2}, skipped.Hits())
+	covered, total := skipped.Summary()
+	assert.Equal(t, 4, covered)
+	assert.Equal(t, 5, total)
+	assert.Equal(t, []CoverageRange{{5, 6}}, skipped.Uncovered())
+
+	report := &bytes.Buffer{}
+	assert.NoError(t, skipped.Report(report))
+	assert.True(t, strings.HasPrefix(report.String(), "Coverage: 4 of 5 instructions (80.00%)\n\n"+
+		"         2          INP  [D0010]                    ; #0000\n"+
+		"         2          JEZ  [D0010], L0007             ; #0002\n"+
+		"         -          OUT  1                          ; #0005\n"+
+		"         2  L0007:  OUT  2                          ; #0007\n",
+	), report.String())
+	assert.True(t, strings.HasSuffix(report.String(), "Uncovered:\n\t#0005-#0006\n"), report.String())
+
+	page := &bytes.Buffer{}
+	assert.NoError(t, skipped.WriteHTML(page))
+	assert.Contains(t, page.String(), `<span class="uncovered" id="a5"><span class="hits">-</span>`)
+	assert.Contains(t, page.String(), `<a href="#a5">#0005-#0006</a>`)
+
+	taken := NewCoverage()
+	run(taken, 1)
+	assert.NoError(t, skipped.Merge(taken))
+	assert.Equal(t, map[int]int{0: 3, 2: 3, 5: 1, 7: 3, 9: 3}, skipped.Hits())
+	assert.Empty(t, skipped.Uncovered())
+
+	other := NewCoverage()
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("99"))
+	assert.NoError(t, other.Attach(&m))
+	assert.EqualError(t, skipped.Merge(other), "Cannot merge coverage: programs differ")
+	assert.EqualError(t, skipped.Attach(&m), "Cannot attach coverage: machine holds a different program")
+
+	other.Detach(&m)
+	m.Run(false)
+	assert.Empty(t, other.Hits())
+}
+
+func TestCoverageMachineCopies(t *testing.T) {
+	c := NewCoverage()
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,1,1,0,99"))
+	copied := m
+	assert.NoError(t, c.Attach(&m))
+	assert.NoError(t, c.Attach(&copied))
+	start := m.Snapshot()
+	m.Run(false)
+	assert.Equal(t, map[int]int{0: 1, 4: 1}, c.Hits())
+
+	c.Detach(&copied)
+	assert.NoError(t, m.RestoreSnapshot(start))
+	m.Run(false)
+	assert.Equal(t, map[int]int{0: 1, 4: 1}, c.Hits())
+}
+
+func TestCoverageFarAddress(t *testing.T) {
+	c := NewCoverage()
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,1,1,1099511627776,1105,1,11,0,0,0,0,99"))
+	m.WriteRAM(80, 7)
+	assert.NoError(t, c.Attach(&m))
+	m.Run(false)
+	assert.Equal(t, map[int]int{0: 1, 4: 1, 11: 1}, c.Hits())
+	covered, total := c.Summary()
+	assert.Equal(t, 3, covered)
+	assert.Equal(t, 3, total)
+}
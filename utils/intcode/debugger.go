@@ -0,0 +1,503 @@
+package intcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Debugger controls execution of a machine with breakpoints, watchpoints and stepping
+type Debugger struct {
+	nopHook
+	machine *Machine
+
+	breakpoints map[address]*Breakpoint
+	watchpoints map[address]WatchKind
+
+	watchHits []MemoryAccess
+	// halt records where the machine halted, so that it is not stepped again unless it has since
+	// been moved, e.g. by restoring a saved state or rewinding
+	halt *debugHalt
+}
+
+// Breakpoint stops execution when the instruction pointer reaches an address
+type Breakpoint struct {
+	Address int
+	// Condition, if set, must also hold for the breakpoint to trigger
+	Condition *BreakCondition
+}
+
+// BreakCondition compares a register against a value
+type BreakCondition struct {
+	Register   registerID
+	Comparison string
+	Value      int
+}
+
+// WatchKind selects which memory accesses trigger a watchpoint
+type WatchKind int
+
+const (
+	// WatchRead triggers on operands read from the address
+	WatchRead WatchKind = 1 << iota
+	// WatchWrite triggers on values written to the address
+	WatchWrite
+
+	// WatchAccess triggers on any read or write
+	WatchAccess = WatchRead | WatchWrite
+)
+
+// MemoryAccess describes a single read or write made by an operation
+type MemoryAccess struct {
+	Address  int
+	Write    bool
+	Value    int
+	Previous int
+}
+
+func (a MemoryAccess) String() string {
+	if a.Write {
+		return fmt.Sprintf("write %v: %d -> %d", address(a.Address), a.Previous, a.Value)
+	}
+	return fmt.Sprintf("read %v: %d", address(a.Address), a.Value)
+}
+
+// DebugEventKind identifies why the debugger returned control
+type DebugEventKind int
+
+const (
+	// DebugEventStepped indicates the requested steps completed
+	DebugEventStepped DebugEventKind = iota
+	// DebugEventBreakpoint indicates a breakpoint was reached
+	DebugEventBreakpoint
+	// DebugEventWatchpoint indicates a watched address was accessed
+	DebugEventWatchpoint
+	// DebugEventHalted indicates the machine stopped running
+	DebugEventHalted
+	// DebugEventNeedInput indicates the machine is waiting for input to be queued
+	DebugEventNeedInput
+)
+
+// DebugEvent reports the state in which the debugger stopped
+type DebugEvent struct {
+	Kind     DebugEventKind
+	Address  int
+	RC       ExecReturnCode
+	Accesses []MemoryAccess
+	// Err is the reason execution failed, for an invalid instruction
+	Err error
+}
+
+func (e DebugEvent) String() string {
+	switch e.Kind {
+	case DebugEventBreakpoint:
+		return fmt.Sprintf("Breakpoint at %v", address(e.Address))
+	case DebugEventWatchpoint:
+		accesses := make([]string, len(e.Accesses))
+		for i, access := range e.Accesses {
+			accesses[i] = access.String()
+		}
+		return fmt.Sprintf("Watchpoint at %v: %s", address(e.Address), strings.Join(accesses, ", "))
+	case DebugEventNeedInput:
+		return fmt.Sprintf("Waiting for input at %v", address(e.Address))
+	case DebugEventHalted:
+		if e.Err != nil {
+			return fmt.Sprintf("Halted at %v (RC %d): %v", address(e.Address), e.RC, e.Err)
+		}
+		return fmt.Sprintf("Halted at %v (RC %d)", address(e.Address), e.RC)
+	}
+	return fmt.Sprintf("Stopped at %v", address(e.Address))
+}
+
+// NewDebugger attaches a debugger to a machine
+func NewDebugger(m *Machine) *Debugger {
+	d := &Debugger{
+		machine:     m,
+		breakpoints: map[address]*Breakpoint{},
+		watchpoints: map[address]WatchKind{},
+	}
+	m.addHook(d)
+	return d
+}
+
+// Detach removes the debugger from the machine
+func (d *Debugger) Detach() {
+	d.machine.removeHook(d)
+}
+
+// AddBreakpoint stops execution whenever the instruction pointer reaches addr
+func (d *Debugger) AddBreakpoint(addr int) {
+	d.breakpoints[address(addr)] = &Breakpoint{Address: addr}
+}
+
+// AddConditionalBreakpoint stops execution at addr only when the condition holds
+func (d *Debugger) AddConditionalBreakpoint(addr int, condition BreakCondition) error {
+	if _, err := condition.compare(0); err != nil {
+		return err
+	}
+	d.breakpoints[address(addr)] = &Breakpoint{Address: addr, Condition: &condition}
+	return nil
+}
+
+// RemoveBreakpoint clears any breakpoint at addr
+func (d *Debugger) RemoveBreakpoint(addr int) {
+	delete(d.breakpoints, address(addr))
+}
+
+// Breakpoints lists the configured breakpoints in address order
+func (d *Debugger) Breakpoints() []Breakpoint {
+	list := []Breakpoint{}
+	for _, bp := range d.breakpoints {
+		list = append(list, *bp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
+
+// Watch stops execution after an operation accesses addr
+func (d *Debugger) Watch(addr int, kind WatchKind) {
+	d.watchpoints[address(addr)] |= kind
+}
+
+// Unwatch clears any watchpoint on addr
+func (d *Debugger) Unwatch(addr int) {
+	delete(d.watchpoints, address(addr))
+}
+
+// Step executes a single instruction, ignoring breakpoints
+func (d *Debugger) Step() DebugEvent {
+	event := d.step()
+	if event.Kind == DebugEventBreakpoint {
+		event.Kind = DebugEventStepped
+	}
+	return event
+}
+
+// Next executes until the instruction following the current one is reached, stepping over any
+// subroutine called by it
+func (d *Debugger) Next() DebugEvent {
+	ip := d.machine.Register(RegisterInstructionPointer)
+	op, err := d.machine.model.decodeAddress(address(ip))
+	if err != nil {
+		return d.Step()
+	}
+	return d.runUntil(ip + 1 + op.NumParams())
+}
+
+// Continue executes until a breakpoint or watchpoint triggers or the machine halts
+func (d *Debugger) Continue() DebugEvent {
+	return d.runUntil(-1)
+}
+
+func (d *Debugger) runUntil(target int) DebugEvent {
+	for {
+		event := d.step()
+		if event.Kind != DebugEventStepped || event.Address == target {
+			return event
+		}
+	}
+}
+
+// debugHalt is the state in which the machine halted
+type debugHalt struct {
+	ip, count int
+	rc        ExecReturnCode
+}
+
+func (d *Debugger) step() DebugEvent {
+	ip := d.machine.Register(RegisterInstructionPointer)
+	if h := d.halt; h != nil {
+		if h.ip == ip && h.count == d.machine.instructionCount {
+			return DebugEvent{Kind: DebugEventHalted, Address: ip, RC: h.rc}
+		}
+		d.halt = nil
+	}
+
+	d.watchHits = nil
+	rc, err := d.machine.TryStep()
+	ip = d.machine.Register(RegisterInstructionPointer)
+	event := DebugEvent{Kind: DebugEventStepped, Address: ip, RC: rc, Err: err}
+	switch {
+	case err != nil:
+		// The machine is unchanged, so the instruction may be retried once memory is corrected
+		event.Kind = DebugEventHalted
+	case rc == ExecRCNeedInput:
+		event.Kind = DebugEventNeedInput
+	case rc != ExecRCNone && rc != ExecRCInterrupt:
+		d.halt = &debugHalt{ip, d.machine.instructionCount, rc}
+		event.Kind = DebugEventHalted
+	case len(d.watchHits) > 0:
+		event.Kind = DebugEventWatchpoint
+		event.Accesses = d.watchHits
+	case d.breakpointHit(address(ip)):
+		event.Kind = DebugEventBreakpoint
+	}
+	return event
+}
+
+func (d *Debugger) breakpointHit(ip address) bool {
+	bp, found := d.breakpoints[ip]
+	if !found {
+		return false
+	}
+	if bp.Condition == nil {
+		return true
+	}
+	hit, _ := bp.Condition.compare(d.machine.Register(bp.Condition.Register))
+	return hit
+}
+
+func (d *Debugger) memoryRead(addr address, value int) {
+	if d.watchpoints[addr]&WatchRead != 0 {
+		d.watchHits = append(d.watchHits, MemoryAccess{Address: int(addr), Value: value, Previous: value})
+	}
+}
+
+func (d *Debugger) memoryWrite(addr address, previous, value int) {
+	if d.watchpoints[addr]&WatchWrite != 0 {
+		d.watchHits = append(d.watchHits, MemoryAccess{Address: int(addr), Write: true, Value: value, Previous: previous})
+	}
+}
+
+// Current describes the instruction at the instruction pointer, with dereferenced operands
+func (d *Debugger) Current() string {
+	ip := address(d.machine.Register(RegisterInstructionPointer))
+	op, err := d.machine.model.decodeAddress(ip)
+	if err != nil {
+		return fmt.Sprintf("%v:\t?? %d", ip, d.machine.readAddress(ip))
+	}
+	return fmt.Sprintf("%v:\t%v", ip, op)
+}
+
+func (c BreakCondition) compare(value int) (bool, error) {
+	switch c.Comparison {
+	case "==":
+		return value == c.Value, nil
+	case "!=":
+		return value != c.Value, nil
+	case "<":
+		return value < c.Value, nil
+	case "<=":
+		return value <= c.Value, nil
+	case ">":
+		return value > c.Value, nil
+	case ">=":
+		return value >= c.Value, nil
+	}
+	return false, fmt.Errorf("Unknown comparison %q", c.Comparison)
+}
+
+func (c BreakCondition) String() string {
+	return fmt.Sprintf("%s %s %d", registerName(c.Register), c.Comparison, c.Value)
+}
+
+var registerNames = map[string]registerID{
+	"ip":  RegisterInstructionPointer,
+	"rb":  M19RelativeBase,
+	"out": M19RegisterOutput,
+}
+
+func registerName(reg registerID) string {
+	for name, id := range registerNames {
+		if id == reg {
+			return name
+		}
+	}
+	return fmt.Sprintf("r%d", reg)
+}
+
+const debuggerHelp = `Commands:
+  s, step [n]              execute n instructions (default 1)
+  n, next                  execute until the following instruction
+  c, continue              run until a breakpoint, watchpoint or halt
+  b, break ADDR [if REG OP VALUE]
+                           set a breakpoint, e.g. "break 12 if rb > 100"
+  d, delete ADDR           remove a breakpoint
+  w, watch ADDR [r|w|rw]   stop when an address is read and/or written
+  u, unwatch ADDR          remove a watchpoint
+  p, print                 show the current instruction
+  r, regs                  show registers
+  x ADDR [N]               examine N memory cells
+  q, quit                  leave the debugger
+An empty line repeats the previous command.`
+
+// Prompt runs a line-oriented command interface, reading commands from in until it is exhausted
+// or a quit command is given
+func (d *Debugger) Prompt(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	lastCommand := ""
+	fmt.Fprintln(out, d.Current())
+	for {
+		fmt.Fprint(out, "(icdb) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		command := strings.TrimSpace(scanner.Text())
+		if command == "" {
+			command = lastCommand
+		}
+		lastCommand = command
+		if command == "" {
+			continue
+		}
+		quit, err := d.runCommand(command, out)
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+func (d *Debugger) runCommand(command string, out io.Writer) (bool, error) {
+	fields := strings.Fields(command)
+	args := fields[1:]
+	report := func(event DebugEvent) {
+		if event.Kind != DebugEventStepped {
+			fmt.Fprintln(out, event)
+		}
+		fmt.Fprintln(out, d.Current())
+	}
+
+	switch fields[0] {
+	case "s", "step":
+		count := 1
+		if len(args) > 0 {
+			var err error
+			if count, err = strconv.Atoi(args[0]); err != nil {
+				return false, fmt.Errorf("Bad step count %q", args[0])
+			}
+		}
+		var event DebugEvent
+		for i := 0; i < count; i++ {
+			event = d.Step()
+			if event.Kind != DebugEventStepped {
+				break
+			}
+		}
+		report(event)
+	case "n", "next":
+		report(d.Next())
+	case "c", "continue":
+		report(d.Continue())
+	case "b", "break":
+		if len(args) == 0 {
+			for _, bp := range d.Breakpoints() {
+				if bp.Condition != nil {
+					fmt.Fprintf(out, "%v if %v\n", address(bp.Address), bp.Condition)
+				} else {
+					fmt.Fprintf(out, "%v\n", address(bp.Address))
+				}
+			}
+			return false, nil
+		}
+		addr, err := parseDebugAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		if len(args) == 1 {
+			d.AddBreakpoint(addr)
+			return false, nil
+		}
+		if len(args) != 5 || args[1] != "if" {
+			return false, fmt.Errorf("Usage: break ADDR [if REG OP VALUE]")
+		}
+		reg, found := registerNames[args[2]]
+		if !found {
+			return false, fmt.Errorf("Unknown register %q", args[2])
+		}
+		value, err := strconv.Atoi(args[4])
+		if err != nil {
+			return false, fmt.Errorf("Bad value %q", args[4])
+		}
+		return false, d.AddConditionalBreakpoint(addr, BreakCondition{reg, args[3], value})
+	case "d", "delete":
+		if len(args) != 1 {
+			return false, fmt.Errorf("Usage: delete ADDR")
+		}
+		addr, err := parseDebugAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.RemoveBreakpoint(addr)
+	case "w", "watch":
+		if len(args) < 1 || len(args) > 2 {
+			return false, fmt.Errorf("Usage: watch ADDR [r|w|rw]")
+		}
+		addr, err := parseDebugAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		kind := WatchWrite
+		if len(args) == 2 {
+			switch args[1] {
+			case "r":
+				kind = WatchRead
+			case "w":
+				kind = WatchWrite
+			case "rw":
+				kind = WatchAccess
+			default:
+				return false, fmt.Errorf("Unknown watch kind %q", args[1])
+			}
+		}
+		d.Watch(addr, kind)
+	case "u", "unwatch":
+		if len(args) != 1 {
+			return false, fmt.Errorf("Usage: unwatch ADDR")
+		}
+		addr, err := parseDebugAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.Unwatch(addr)
+	case "p", "print":
+		fmt.Fprintln(out, d.Current())
+	case "r", "regs":
+		names := []string{}
+		for name := range registerNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "%s\t%d\n", name, d.machine.Register(registerNames[name]))
+		}
+	case "x":
+		if len(args) < 1 || len(args) > 2 {
+			return false, fmt.Errorf("Usage: x ADDR [N]")
+		}
+		addr, err := parseDebugAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		count := 1
+		if len(args) == 2 {
+			if count, err = strconv.Atoi(args[1]); err != nil {
+				return false, fmt.Errorf("Bad count %q", args[1])
+			}
+		}
+		for i := 0; i < count; i++ {
+			fmt.Fprintf(out, "%v:\t%d\n", address(addr+i), d.machine.readAddress(address(addr+i)))
+		}
+	case "h", "help":
+		fmt.Fprintln(out, debuggerHelp)
+	case "q", "quit":
+		return true, nil
+	default:
+		return false, fmt.Errorf("Unknown command %q (try help)", fields[0])
+	}
+	return false, nil
+}
+
+func parseDebugAddress(arg string) (int, error) {
+	addr, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil || addr < 0 {
+		return 0, fmt.Errorf("Bad address %q", arg)
+	}
+	return addr, nil
+}
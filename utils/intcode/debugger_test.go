@@ -0,0 +1,188 @@
+package intcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const debuggerTestSource = `
+	       ARB  100
+	loop:  ADD  [counter], 1, [counter]
+	       ARB  1
+	       CLT  [counter], 5, [flag]
+	       JNZ  [flag], loop
+	       OUT  [counter]
+	       HCF
+	counter: DATA 0
+	flag:    DATA 0
+`
+
+func newDebuggerTestMachine(t *testing.T) (*Machine, *Debugger) {
+	program, err := Assemble(debuggerTestSource)
+	assert.NoError(t, err)
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram(program))
+	return &m, NewDebugger(&m)
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	m, d := newDebuggerTestMachine(t)
+
+	d.AddBreakpoint(2)
+	for i := 0; i < 4; i++ {
+		event := d.Continue()
+		assert.Equal(t, DebugEventBreakpoint, event.Kind)
+		assert.Equal(t, 2, event.Address)
+	}
+	assert.Equal(t, 3, m.ReadRAM(18))
+
+	d.RemoveBreakpoint(2)
+	event := d.Continue()
+	assert.Equal(t, DebugEventHalted, event.Kind)
+	assert.Equal(t, ExecRCHCF, event.RC)
+	assert.Equal(t, 5, m.Register(M19RegisterOutput))
+
+	event = d.Step()
+	assert.Equal(t, DebugEventHalted, event.Kind)
+}
+
+func TestDebuggerConditionalBreakpoint(t *testing.T) {
+	m, d := newDebuggerTestMachine(t)
+
+	assert.Error(t, d.AddConditionalBreakpoint(2, BreakCondition{M19RelativeBase, "~", 0}))
+	assert.NoError(t, d.AddConditionalBreakpoint(2, BreakCondition{M19RelativeBase, ">=", 103}))
+	event := d.Continue()
+	assert.Equal(t, DebugEventBreakpoint, event.Kind)
+	assert.Equal(t, 103, m.Register(M19RelativeBase))
+	assert.Equal(t, 3, m.ReadRAM(18))
+}
+
+func TestDebuggerWatchpoints(t *testing.T) {
+	m, d := newDebuggerTestMachine(t)
+
+	d.Watch(19, WatchWrite)
+	event := d.Continue()
+	assert.Equal(t, DebugEventWatchpoint, event.Kind)
+	assert.Equal(t, 12, m.Register(RegisterInstructionPointer))
+	assert.Equal(t, []MemoryAccess{{Address: 19, Write: true, Value: 1, Previous: 0}}, event.Accesses)
+
+	d.Unwatch(19)
+	d.Watch(18, WatchRead)
+	event = d.Continue()
+	assert.Equal(t, DebugEventWatchpoint, event.Kind)
+	assert.Equal(t, 6, m.Register(RegisterInstructionPointer))
+	assert.Equal(t, "Watchpoint at #0006: read #0018: 1", event.String())
+
+	d.Detach()
+	m.Run(false)
+	assert.Equal(t, 5, m.Register(M19RegisterOutput))
+}
+
+func TestDebuggerNext(t *testing.T) {
+	m, d := newDebuggerTestMachine(t)
+
+	for i := 0; i < 4; i++ {
+		d.Step()
+	}
+	assert.Equal(t, "#0012:\tJNZ\t#19 (1)\t'2'", d.Current())
+
+	// Stepping over the backwards jump runs the rest of the loop
+	event := d.Next()
+	assert.Equal(t, DebugEventStepped, event.Kind)
+	assert.Equal(t, 15, event.Address)
+	assert.Equal(t, 5, m.ReadRAM(18))
+}
+
+func TestDebuggerPrompt(t *testing.T) {
+	_, d := newDebuggerTestMachine(t)
+
+	commands := strings.Join([]string{
+		"break 12 if rb == 102",
+		"b",
+		"c",
+		"regs",
+		"x 18 2",
+		"step 2",
+		"",
+		"bogus",
+		"q",
+		"c",
+	}, "\n")
+	out := &bytes.Buffer{}
+	assert.NoError(t, d.Prompt(strings.NewReader(commands), out))
+
+	expected := strings.Join([]string{
+		"#0000:\tARB\t'100'",
+		"(icdb) (icdb) #0012 if rb == 102",
+		"(icdb) Breakpoint at #0012",
+		"#0012:\tJNZ\t#19 (1)\t'2'",
+		"(icdb) ip\t12",
+		"out\t0",
+		"rb\t102",
+		"(icdb) #0018:\t2",
+		"#0019:\t1",
+		"(icdb) #0006:\tARB\t'1'",
+		"(icdb) #0012:\tJNZ\t#19 (1)\t'2'",
+		"(icdb) Error: Unknown command \"bogus\" (try help)",
+		"(icdb) ",
+	}, "\n")
+	assert.Equal(t, expected, out.String())
+}
+
+func TestDebuggerRestoreAfterHalt(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,2,3,5,99,0"))
+	d := NewDebugger(&m)
+	saved := m.Save()
+
+	assert.Equal(t, DebugEventHalted, d.Continue().Kind)
+	assert.Equal(t, DebugEventHalted, d.Step().Kind)
+	assert.Equal(t, 5, m.ReadRAM(5))
+
+	m.Restore(saved)
+	assert.Equal(t, 0, m.ReadRAM(5))
+	event := d.Step()
+	assert.Equal(t, DebugEventStepped, event.Kind)
+	assert.Equal(t, 5, m.ReadRAM(5))
+	assert.Equal(t, DebugEventHalted, d.Step().Kind)
+	assert.Equal(t, DebugEventHalted, d.Step().Kind)
+}
+
+func TestDebuggerRewindAfterHalt(t *testing.T) {
+	m := NewMachine(M19(nil, nil), History(10, 10, 100))
+	assert.NoError(t, m.LoadProgram("1101,2,3,5,99,0"))
+	d := NewDebugger(&m)
+
+	assert.Equal(t, DebugEventHalted, d.Continue().Kind)
+	assert.Equal(t, DebugEventHalted, d.Step().Kind)
+	assert.Equal(t, 2, m.instructionCount)
+	assert.Equal(t, 5, m.ReadRAM(5))
+
+	assert.NoError(t, m.RewindTo(0))
+	assert.Equal(t, 0, m.ReadRAM(5))
+	event := d.Step()
+	assert.Equal(t, DebugEventStepped, event.Kind)
+	assert.Equal(t, 1, m.instructionCount)
+	assert.Equal(t, 5, m.ReadRAM(5))
+	assert.Equal(t, DebugEventHalted, d.Step().Kind)
+	assert.Equal(t, DebugEventHalted, d.Step().Kind)
+	assert.Equal(t, 2, m.instructionCount)
+}
+
+func TestDebuggerNeedInput(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("3,5,4,5,99,0"))
+	d := NewDebugger(&m)
+
+	event := d.Continue()
+	assert.Equal(t, DebugEventNeedInput, event.Kind)
+	assert.Equal(t, "Waiting for input at #0000", event.String())
+
+	m.QueueInput(42)
+	event = d.Continue()
+	assert.Equal(t, DebugEventHalted, event.Kind)
+	assert.Equal(t, 42, m.Register(M19RegisterOutput))
+}
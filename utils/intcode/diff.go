@@ -0,0 +1,231 @@
+package intcode
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// MachineDiff describes the differences between the states of two machines
+type MachineDiff struct {
+	Registers    []RegisterChange
+	RAM          []RangeChange
+	Big          []BigChange
+	Instructions []InstructionChange
+}
+
+// RegisterChange is a register holding different values in two machines
+type RegisterChange struct {
+	Register registerID
+	Old, New int
+}
+
+// RangeChange is a run of consecutive addresses holding different values in two machines
+//
+// Addresses which have not been set are treated as zero.
+type RangeChange struct {
+	Start    int
+	Old, New []int
+}
+
+// BigChange is an address holding different exact values in two machines, where at least one of
+// them has promoted the value with OverflowPromote
+type BigChange struct {
+	Address  int
+	Old, New *big.Int
+}
+
+// InstructionChange is an instruction covering a changed address, as decoded in each machine
+//
+// Old or New is empty if the address is not part of an instruction in that machine.
+type InstructionChange struct {
+	Address  int
+	Old, New string
+}
+
+// Diff compares the registers and RAM of two machines
+//
+// Instructions are decoded with each machine's model, following control flow from address 0 and
+// the machine's instruction pointer.
+func Diff(a, b *Machine) *MachineDiff {
+	d := &MachineDiff{
+		Registers: a.registers.diff(b.registers),
+		RAM:       diffMemory(a.ram, b.ram),
+		Big:       diffBig(a, b),
+	}
+	if len(d.RAM) == 0 {
+		return d
+	}
+
+	oldCode, newCode := a.Disassemble(), b.Disassemble()
+	starts := []int{}
+	seen := map[int]bool{}
+	for _, change := range d.RAM {
+		for addr := change.Start; addr < change.Start+len(change.Old); addr++ {
+			for _, code := range []*Disassembly{oldCode, newCode} {
+				if line, found := code.lineAt(addr); found && !seen[line.Address] {
+					seen[line.Address] = true
+					starts = append(starts, line.Address)
+				}
+			}
+		}
+	}
+	sort.Ints(starts)
+	for _, start := range starts {
+		instruction := InstructionChange{
+			Address: start,
+			Old:     oldCode.instructionAt(start),
+			New:     newCode.instructionAt(start),
+		}
+		if instruction.Old != instruction.New {
+			d.Instructions = append(d.Instructions, instruction)
+		}
+	}
+	return d
+}
+
+// DiffSnapshots compares the states held in two snapshots
+func DiffSnapshots(a, b *Snapshot) (*MachineDiff, error) {
+	ma, err := snapshotMachine(a)
+	if err != nil {
+		return nil, err
+	}
+	mb, err := snapshotMachine(b)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(ma, mb), nil
+}
+
+// snapshotMachine creates a machine without I/O holding the state of a snapshot
+func snapshotMachine(s *Snapshot) (*Machine, error) {
+	model, found := LookupModel(s.Model)
+	if !found {
+		return nil, fmt.Errorf("Cannot restore machine: unknown model %s", s.Model)
+	}
+	m := NewMachine(WithModel(model, nil, nil), Overflow(s.Overflow))
+	if err := m.RestoreSnapshot(s); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Empty reports whether no differences were found
+func (d *MachineDiff) Empty() bool {
+	return len(d.Registers) == 0 && len(d.RAM) == 0 && len(d.Big) == 0
+}
+
+func (d *MachineDiff) String() string {
+	lines := []string{}
+	if len(d.Registers) > 0 {
+		lines = append(lines, "Registers:")
+		for _, change := range d.Registers {
+			lines = append(lines, fmt.Sprintf("\t%s: %d -> %d", registerName(change.Register), change.Old, change.New))
+		}
+	}
+	if len(d.RAM) > 0 {
+		lines = append(lines, "RAM:")
+		for _, change := range d.RAM {
+			span := address(change.Start).String()
+			if len(change.Old) > 1 {
+				span += "-" + address(change.Start+len(change.Old)-1).String()
+			}
+			lines = append(lines, fmt.Sprintf("\t%s: %v -> %v", span, change.Old, change.New))
+		}
+	}
+	if len(d.Big) > 0 {
+		lines = append(lines, "Big values:")
+		for _, change := range d.Big {
+			lines = append(lines, fmt.Sprintf("\t%v: %v -> %v", address(change.Address), change.Old, change.New))
+		}
+	}
+	if len(d.Instructions) > 0 {
+		lines = append(lines, "Instructions:")
+		for _, change := range d.Instructions {
+			lines = append(lines, fmt.Sprintf("\t%v: %s -> %s", address(change.Address), instructionOrData(change.Old), instructionOrData(change.New)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func instructionOrData(instruction string) string {
+	if instruction == "" {
+		return "(data)"
+	}
+	return instruction
+}
+
+// diff lists the registers which differ, treating missing registers as zero
+func (r registerList) diff(other registerList) []RegisterChange {
+	changes := []RegisterChange{}
+	for reg, value := range r {
+		if other[reg] != value {
+			changes = append(changes, RegisterChange{reg, value, other[reg]})
+		}
+	}
+	for reg, value := range other {
+		if _, found := r[reg]; !found && value != 0 {
+			changes = append(changes, RegisterChange{reg, 0, value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Register < changes[j].Register })
+	return changes
+}
+
+// diffMemory lists the runs of addresses which differ, treating unset addresses as zero
+func diffMemory(a, b memory) []RangeChange {
+	addrsA, addrsB := a.addresses(), b.addresses()
+	changes := []RangeChange{}
+	compare := func(addr address) {
+		oldValue, _ := a.read(addr)
+		newValue, _ := b.read(addr)
+		if oldValue == newValue {
+			return
+		}
+		last := len(changes) - 1
+		if last >= 0 && changes[last].Start+len(changes[last].Old) == int(addr) {
+			changes[last].Old = append(changes[last].Old, oldValue)
+			changes[last].New = append(changes[last].New, newValue)
+			return
+		}
+		changes = append(changes, RangeChange{int(addr), []int{oldValue}, []int{newValue}})
+	}
+	for i, j := 0, 0; i < len(addrsA) || j < len(addrsB); {
+		switch {
+		case j == len(addrsB) || (i < len(addrsA) && addrsA[i] < addrsB[j]):
+			compare(addrsA[i])
+			i++
+		case i == len(addrsA) || addrsB[j] < addrsA[i]:
+			compare(addrsB[j])
+			j++
+		default:
+			compare(addrsA[i])
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+// diffBig lists the promoted addresses in either machine whose exact values differ
+func diffBig(a, b *Machine) []BigChange {
+	addrs := []int{}
+	for addr := range a.bigValues {
+		addrs = append(addrs, int(addr))
+	}
+	for addr := range b.bigValues {
+		if _, found := a.bigValues[addr]; !found {
+			addrs = append(addrs, int(addr))
+		}
+	}
+	sort.Ints(addrs)
+	changes := []BigChange{}
+	for _, addr := range addrs {
+		oldValue, newValue := a.ReadBig(address(addr)), b.ReadBig(address(addr))
+		if oldValue.Cmp(newValue) != 0 {
+			changes = append(changes, BigChange{addr, oldValue, newValue})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,90 @@
+package intcode
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	a := NewMachine(M19(nil, nil))
+	assert.NoError(t, a.LoadProgram("1101,1,2,9,1102,3,4,10,99,0,0"))
+	b := a.Clone()
+	assert.True(t, Diff(&a, &b).Empty())
+
+	b.WriteRAM(4, 1101)
+	b.Step()
+	b.Step()
+	a.Step()
+	a.WriteRAM(20, 5)
+
+	d := Diff(&a, &b)
+	assert.Equal(t, []RegisterChange{{RegisterInstructionPointer, 4, 8}}, d.Registers)
+	assert.Equal(t, []RangeChange{
+		{Start: 4, Old: []int{1102}, New: []int{1101}},
+		{Start: 10, Old: []int{0}, New: []int{7}},
+		{Start: 20, Old: []int{5}, New: []int{0}},
+	}, d.RAM)
+	assert.Equal(t, []InstructionChange{
+		{Address: 4, Old: "MUL  3, 4, [10]", New: "ADD  3, 4, [10]"},
+	}, d.Instructions)
+	assert.Equal(t, "Registers:\n"+
+		"\tip: 4 -> 8\n"+
+		"RAM:\n"+
+		"\t#0004: [1102] -> [1101]\n"+
+		"\t#0010: [0] -> [7]\n"+
+		"\t#0020: [5] -> [0]\n"+
+		"Instructions:\n"+
+		"\t#0004: MUL  3, 4, [10] -> ADD  3, 4, [10]",
+		d.String())
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,1,2,5,99,0"))
+	before := m.Snapshot()
+	m.Run(false)
+
+	d, err := DiffSnapshots(before, m.Snapshot())
+	assert.NoError(t, err)
+	assert.Equal(t, []RangeChange{{Start: 5, Old: []int{0}, New: []int{3}}}, d.RAM)
+	assert.Empty(t, d.Instructions)
+
+	other := m.Snapshot()
+	other.Model = "M20"
+	_, err = DiffSnapshots(before, other)
+	assert.Error(t, err)
+}
+
+func TestDiffModel(t *testing.T) {
+	a := NewMachine(Day2())
+	assert.NoError(t, a.LoadProgram("1,5,6,7,99,3,4,0"))
+	b := a.Clone()
+	b.WriteRAM(0, 1001)
+
+	d := Diff(&a, &b)
+	assert.Equal(t, []InstructionChange{{Address: 0, Old: "ADD  [5], [6], [7]", New: ""}}, d.Instructions)
+
+	d, err := DiffSnapshots(a.Snapshot(), b.Snapshot())
+	assert.NoError(t, err)
+	assert.Equal(t, []InstructionChange{{Address: 0, Old: "ADD  [5], [6], [7]", New: ""}}, d.Instructions)
+}
+
+func TestDiffBig(t *testing.T) {
+	a := NewMachine(M19(nil, nil), Overflow(OverflowPromote))
+	assert.NoError(t, a.LoadProgram("99,0"))
+	b := a.Clone()
+	huge := new(big.Int).Lsh(big.NewInt(1), 64)
+	b.WriteBig(1, huge)
+
+	d := Diff(&a, &b)
+	assert.Empty(t, d.RAM)
+	assert.Equal(t, []BigChange{{Address: 1, Old: big.NewInt(0), New: huge}}, d.Big)
+	assert.False(t, d.Empty())
+	assert.Equal(t, "Big values:\n\t#0001: 0 -> 18446744073709551616", d.String())
+
+	d, err := DiffSnapshots(b.Snapshot(), a.Snapshot())
+	assert.NoError(t, err)
+	assert.Equal(t, []BigChange{{Address: 1, Old: huge, New: big.NewInt(0)}}, d.Big)
+}
@@ -0,0 +1,98 @@
+package intcode
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Reference is an independent intcode interpreter which a Machine can be compared against
+type Reference interface {
+	// Step executes a single instruction, returning true once the program has halted
+	Step() bool
+	// InstructionPointer returns the address of the next instruction
+	InstructionPointer() int
+	// Memory returns the values stored in memory, by address
+	Memory() map[int]int
+}
+
+// Divergence describes the first point at which a Machine and a Reference disagreed
+type Divergence struct {
+	// Instruction is the number of the instruction after which the states differed, or 0 if
+	// they differed before any were executed
+	Instruction int
+	// Address is the location of that instruction
+	Address int
+	// Opcode is the raw value of that instruction
+	Opcode int
+	// Reason describes the difference
+	Reason string
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("Diverged at instruction %d (%v, opcode %d): %s", d.Instruction, address(d.Address), d.Opcode, d.Reason)
+}
+
+// Compare executes m and ref in lockstep for up to maxInstructions instructions, returning the
+// first point at which their instruction pointers, memory or halt states differ
+//
+// Both interpreters must be supplied with the same input. Memory which has not been set is
+// treated as zero, and nil is returned if no difference is found.
+func Compare(m *Machine, ref Reference, maxInstructions int) *Divergence {
+	divergence := Divergence{}
+	if reason := compareState(m, ref, false); reason != "" {
+		divergence.Reason = reason
+		return &divergence
+	}
+	for count := 1; count <= maxInstructions; count++ {
+		divergence = Divergence{
+			Instruction: count,
+			Address:     m.Register(RegisterInstructionPointer),
+		}
+		divergence.Opcode = m.readAddress(address(divergence.Address))
+
+		rc := m.Step()
+		machineHalted := rc != ExecRCNone && rc != ExecRCInterrupt
+		refHalted := ref.Step()
+		if machineHalted != refHalted {
+			divergence.Reason = fmt.Sprintf("halted %v, reference halted %v", machineHalted, refHalted)
+			return &divergence
+		}
+		if reason := compareState(m, ref, machineHalted); reason != "" {
+			divergence.Reason = reason
+			return &divergence
+		}
+		if machineHalted {
+			break
+		}
+	}
+	return nil
+}
+
+// compareState describes the first difference between two interpreters, or returns an empty string
+//
+// The instruction pointers of halted interpreters are not compared.
+func compareState(m *Machine, ref Reference, halted bool) string {
+	ip, refIP := m.Register(RegisterInstructionPointer), ref.InstructionPointer()
+	if ip != refIP && !halted {
+		return fmt.Sprintf("instruction pointer %v, reference %v", address(ip), address(refIP))
+	}
+
+	refMemory := ref.Memory()
+	differences := []int{}
+	for addr, refValue := range refMemory {
+		if m.readAddress(address(addr)) != refValue {
+			differences = append(differences, addr)
+		}
+	}
+	for _, addr := range m.ram.addresses() {
+		if _, found := refMemory[int(addr)]; !found && m.readAddress(addr) != 0 {
+			differences = append(differences, int(addr))
+		}
+	}
+	if len(differences) == 0 {
+		return ""
+	}
+	sort.Ints(differences)
+	addr := differences[0]
+	return fmt.Sprintf("memory %v is %d, reference %d", address(addr), m.readAddress(address(addr)), refMemory[addr])
+}
@@ -0,0 +1,56 @@
+package intcode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type machineReference struct {
+	m *Machine
+}
+
+func (r machineReference) Step() bool {
+	rc := r.m.Step()
+	return rc != ExecRCNone && rc != ExecRCInterrupt
+}
+
+func (r machineReference) InstructionPointer() int { return r.m.Register(RegisterInstructionPointer) }
+func (r machineReference) Memory() map[int]int     { return r.m.Memory() }
+
+func newCompareTestMachine(t *testing.T, program string, inputs ...int) *Machine {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram(program))
+	m.QueueInput(inputs...)
+	return &m
+}
+
+func TestCompare(t *testing.T) {
+	program := "3,13,3,14,1,13,14,15,8,15,16,15,99,0,0,0,7"
+
+	m := newCompareTestMachine(t, program, 3, 4)
+	ref := newCompareTestMachine(t, program, 3, 4)
+	assert.Nil(t, Compare(m, machineReference{ref}, 100))
+
+	m = newCompareTestMachine(t, program, 3, 4)
+	ref = newCompareTestMachine(t, program, 3, 5)
+	divergence := Compare(m, machineReference{ref}, 100)
+	assert.Equal(t, &Divergence{
+		Instruction: 2,
+		Address:     2,
+		Opcode:      3,
+		Reason:      "memory #0014 is 4, reference 5",
+	}, divergence)
+	assert.Equal(t, "Diverged at instruction 2 (#0002, opcode 3): memory #0014 is 4, reference 5", divergence.String())
+
+	m = newCompareTestMachine(t, program, 3, 4)
+	ref = newCompareTestMachine(t, "3,13,3,14,1,13,14,15,8,15,16,15,99,0,0,0,8", 3, 4)
+	assert.Equal(t, "memory #0016 is 7, reference 8", Compare(m, machineReference{ref}, 100).Reason)
+
+	m = newCompareTestMachine(t, program, 3, 4)
+	halting := NewMachine(M19(func() (int, bool) { return 0, true }, nil))
+	assert.NoError(t, halting.LoadProgram(program))
+	divergence = Compare(m, machineReference{&halting}, 100)
+	assert.Equal(t, "halted false, reference halted true", divergence.Reason)
+	assert.Equal(t, 1, divergence.Instruction)
+}
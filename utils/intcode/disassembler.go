@@ -0,0 +1,403 @@
+package intcode
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Disassembly is a control-flow aware decode of an intcode program
+type Disassembly struct {
+	Lines []DisassemblyLine
+
+	decode opcodeDecoder
+}
+
+// DisassemblyLine is a single decoded instruction or a run of data values
+type DisassemblyLine struct {
+	Address  int
+	Label    string
+	Code     bool
+	Mnemonic string
+	Operands []string
+	Values   []int
+}
+
+// Disassemble decodes a program, following control flow from address 0 and any extra entry points
+func Disassemble(program string, entryPoints ...int) (*Disassembly, error) {
+	values, err := parseProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	return disassemble(newMemoryImage(values), entryPoints, decodeM19), nil
+}
+
+// Disassemble decodes the current contents of the machine's RAM with the machine's model, following
+// control flow from address 0, the current instruction pointer and any extra entry points
+func (m *Machine) Disassemble(entryPoints ...int) *Disassembly {
+	entryPoints = append(entryPoints, m.Register(RegisterInstructionPointer))
+	return disassemble(m.ramImage(), entryPoints, m.decoder())
+}
+
+// imageMaxGap is the longest run of unset addresses filled with zeros within a memoryImage segment
+const imageMaxGap = 64
+
+// memoryImage is a copy of memory held as segments of consecutive addresses, so that values
+// stored far beyond a program cost no more than those next to it
+type memoryImage struct {
+	segments []imageSegment
+}
+
+// imageSegment is a run of values starting at an address
+type imageSegment struct {
+	start  int
+	values []int
+}
+
+func (seg imageSegment) end() int {
+	return seg.start + len(seg.values)
+}
+
+// newMemoryImage creates an image of a program loaded at address 0
+func newMemoryImage(values []int) memoryImage {
+	if len(values) == 0 {
+		return memoryImage{}
+	}
+	return memoryImage{[]imageSegment{{0, values}}}
+}
+
+// ramImage copies the values set in RAM, filling short gaps between them with zeros
+func (m *Machine) ramImage() memoryImage {
+	img := memoryImage{}
+	for _, addr := range m.ram.addresses() {
+		if addr < 0 {
+			continue
+		}
+		last := len(img.segments) - 1
+		if last < 0 || int(addr)-img.segments[last].end() > imageMaxGap {
+			img.segments = append(img.segments, imageSegment{start: int(addr)})
+			last++
+		}
+		seg := &img.segments[last]
+		for seg.end() < int(addr) {
+			seg.values = append(seg.values, 0)
+		}
+		seg.values = append(seg.values, m.readAddress(addr))
+	}
+	return img
+}
+
+// segment finds the segment holding addr
+func (img memoryImage) segment(addr int) (imageSegment, bool) {
+	i := sort.Search(len(img.segments), func(i int) bool { return img.segments[i].end() > addr })
+	if i == len(img.segments) || img.segments[i].start > addr {
+		return imageSegment{}, false
+	}
+	return img.segments[i], true
+}
+
+// contains reports whether addr lies within the image
+func (img memoryImage) contains(addr int) bool {
+	_, found := img.segment(addr)
+	return found
+}
+
+// value returns the value at addr, or 0 if it lies outside the image
+func (img memoryImage) value(addr int) int {
+	seg, found := img.segment(addr)
+	if !found {
+		return 0
+	}
+	return seg.values[addr-seg.start]
+}
+
+// run returns the n values starting at addr, if they all lie within one segment
+func (img memoryImage) run(addr, n int) ([]int, bool) {
+	seg, found := img.segment(addr)
+	if !found || addr+n > seg.end() {
+		return nil, false
+	}
+	return seg.values[addr-seg.start : addr-seg.start+n], true
+}
+
+// equal compares two images, treating addresses outside either as holding 0
+func (img memoryImage) equal(other memoryImage) bool {
+	nonZero := func(img memoryImage) map[int]int {
+		values := map[int]int{}
+		for _, seg := range img.segments {
+			for i, value := range seg.values {
+				if value != 0 {
+					values[seg.start+i] = value
+				}
+			}
+		}
+		return values
+	}
+	a, b := nonZero(img), nonZero(other)
+	if len(a) != len(b) {
+		return false
+	}
+	for addr, value := range a {
+		if b[addr] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the disassembly as source accepted by Assemble
+//
+// Gaps between the segments of a machine's RAM are skipped with ORG directives, which Assemble
+// only accepts for addresses up to asmMaxOrigin.
+func (d *Disassembly) String() string {
+	lines := make([]string, 0, len(d.Lines))
+	next := 0
+	for _, line := range d.Lines {
+		if line.Address != next {
+			lines = append(lines, fmt.Sprintf("%-8s%-5s%d", "", "ORG", line.Address))
+		}
+		lines = append(lines, line.text())
+		next = line.Address + len(line.Values)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// text renders a line as assembler source, followed by its address as a comment
+func (line DisassemblyLine) text() string {
+	label := ""
+	if line.Label != "" {
+		label = line.Label + ":"
+	}
+	text := fmt.Sprintf("%-8s%-5s%s", label, line.Mnemonic, strings.Join(line.Operands, ", "))
+	return fmt.Sprintf("%-40s; %v", text, address(line.Address))
+}
+
+// Code returns the addresses of all decoded instructions
+func (d *Disassembly) Code() []int {
+	addrs := []int{}
+	for _, line := range d.Lines {
+		if line.Code {
+			addrs = append(addrs, line.Address)
+		}
+	}
+	return addrs
+}
+
+// lineAt finds the decoded instruction covering addr
+func (d *Disassembly) lineAt(addr int) (DisassemblyLine, bool) {
+	i := sort.Search(len(d.Lines), func(i int) bool { return d.Lines[i].Address > addr }) - 1
+	if i < 0 || !d.Lines[i].Code || addr >= d.Lines[i].Address+len(d.Lines[i].Values) {
+		return DisassemblyLine{}, false
+	}
+	return d.Lines[i], true
+}
+
+// instructionAt renders the instruction starting at addr without labels, or returns an empty
+// string if there is none
+func (d *Disassembly) instructionAt(addr int) string {
+	line, found := d.lineAt(addr)
+	if !found || line.Address != addr {
+		return ""
+	}
+	_, modes, _ := d.decode(line.Values[0])
+	operands := make([]string, len(modes))
+	for i, mode := range modes {
+		operands[i] = formatOperand(mode, line.Values[i+1], false, strconv.Itoa)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%-5s%s", line.Mnemonic, strings.Join(operands, ", ")))
+}
+
+const disassemblyDataPerLine = 8
+
+type disassembledOp struct {
+	code  int
+	def   Opcode
+	modes []ParamMode
+}
+
+func disassemble(img memoryImage, entryPoints []int, decode opcodeDecoder) *Disassembly {
+	ops := map[int]disassembledOp{}
+	isCode := map[int]bool{}
+	jumpTargets := map[int]bool{}
+
+	work := append([]int{0}, entryPoints...)
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+
+	flow:
+		for img.contains(addr) {
+			if _, found := ops[addr]; found {
+				break
+			}
+			def, modes, valid := decode(img.value(addr))
+			if !valid || !isCanonicalM19(img.value(addr), def, modes) {
+				break
+			}
+			size := 1 + def.NumParams
+			values, found := img.run(addr, size)
+			if !found {
+				break
+			}
+			for pos := addr; pos < addr+size; pos++ {
+				if isCode[pos] {
+					break flow
+				}
+			}
+			for pos := addr; pos < addr+size; pos++ {
+				isCode[pos] = true
+			}
+			code := m19Flow(def)
+			ops[addr] = disassembledOp{code, def, modes}
+
+			switch code {
+			case m19OpHCF:
+				break flow
+			case m19OpJumpTrue, m19OpJumpFalse:
+				if modes[1] == ModeImmediate {
+					target := values[2]
+					jumpTargets[target] = true
+					work = append(work, target)
+				}
+				if modes[0] == ModeImmediate {
+					test := values[1]
+					if (code == m19OpJumpTrue && test != 0) || (code == m19OpJumpFalse && test == 0) {
+						break flow
+					}
+				}
+			}
+			addr += size
+		}
+	}
+
+	// Work out which addresses deserve labels
+	labels := map[int]string{}
+	addLabel := func(addr int) {
+		if !img.contains(addr) || labels[addr] != "" {
+			return
+		}
+		if _, found := ops[addr]; found {
+			labels[addr] = fmt.Sprintf("L%04d", addr)
+		} else if !isCode[addr] {
+			labels[addr] = fmt.Sprintf("D%04d", addr)
+		}
+	}
+	targets := []int{}
+	for target := range jumpTargets {
+		targets = append(targets, target)
+	}
+	sort.Ints(targets)
+	for _, target := range targets {
+		addLabel(target)
+	}
+	opAddrs := make([]int, 0, len(ops))
+	for addr := range ops {
+		opAddrs = append(opAddrs, addr)
+	}
+	sort.Ints(opAddrs)
+	for _, addr := range opAddrs {
+		for i, mode := range ops[addr].modes {
+			if mode == ModePositional {
+				addLabel(img.value(addr + 1 + i))
+			}
+		}
+	}
+
+	operandLabel := func(value int) string {
+		if labels[value] != "" {
+			return labels[value]
+		}
+		return strconv.Itoa(value)
+	}
+
+	disassembly := &Disassembly{decode: decode}
+	for _, seg := range img.segments {
+		for addr := seg.start; addr < seg.end(); {
+			values := seg.values[addr-seg.start:]
+			if op, found := ops[addr]; found {
+				line := DisassemblyLine{
+					Address:  addr,
+					Label:    labels[addr],
+					Code:     true,
+					Mnemonic: op.def.Name,
+					Operands: make([]string, op.def.NumParams),
+					Values:   values[:1+op.def.NumParams],
+				}
+				for i, mode := range op.modes {
+					isJumpTarget := (op.code == m19OpJumpTrue || op.code == m19OpJumpFalse) && i == 1
+					line.Operands[i] = formatOperand(mode, values[1+i], isJumpTarget, operandLabel)
+				}
+				disassembly.Lines = append(disassembly.Lines, line)
+				addr += len(line.Values)
+				continue
+			}
+
+			line := DisassemblyLine{
+				Address:  addr,
+				Label:    labels[addr],
+				Mnemonic: "DATA",
+			}
+			for end := addr; end < seg.end() && end-addr < disassemblyDataPerLine; end++ {
+				if _, found := ops[end]; found || (end > addr && labels[end] != "") {
+					break
+				}
+				line.Operands = append(line.Operands, strconv.Itoa(values[end-addr]))
+			}
+			line.Values = values[:len(line.Operands)]
+			disassembly.Lines = append(disassembly.Lines, line)
+			addr += len(line.Values)
+		}
+	}
+	return disassembly
+}
+
+// formatOperand renders an instruction parameter, naming any address it refers to with label
+func formatOperand(mode ParamMode, param int, isJumpTarget bool, label func(int) string) string {
+	switch mode {
+	case ModePositional:
+		return "[" + label(param) + "]"
+	case ModeRelative:
+		switch {
+		case param == 0:
+			return "[rb]"
+		case param < 0:
+			return fmt.Sprintf("[rb%d]", param)
+		default:
+			return fmt.Sprintf("[rb+%d]", param)
+		}
+	}
+	if isJumpTarget {
+		return label(param)
+	}
+	return strconv.Itoa(param)
+}
+
+// m19Flow returns the AoC 2019 opcode of an instruction definition, or m19OpNone if it is not
+// one, so that only the jumps and halt of that model are followed as control flow
+func m19Flow(def Opcode) int {
+	if m19Opcodes[def.Code].Name != def.Name {
+		return m19OpNone
+	}
+	return def.Code
+}
+
+// isCanonicalM19 checks that an instruction would be reproduced exactly by the assembler
+func isCanonicalM19(value int, def Opcode, modes []ParamMode) bool {
+	if value < 0 {
+		return false
+	}
+	encoded := value % 100
+	multiplier := 100
+	for i, mode := range modes {
+		if mode > ModeRelative {
+			return false
+		}
+		if i == def.WriteParam && mode == ModeImmediate {
+			return false
+		}
+		encoded += int(mode) * multiplier
+		multiplier *= 10
+	}
+	return encoded == value
+}
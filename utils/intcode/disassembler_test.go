@@ -0,0 +1,117 @@
+package intcode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisassemble(t *testing.T) {
+	program := "1105,1,7,4,9,99,-1,1006,9,3,99"
+
+	d, err := Disassemble(program)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 3, 5, 7, 10}, d.Code())
+
+	expected := []string{
+		"        JNZ  1, L0007                   ; #0000",
+		"L0003:  OUT  [9]                        ; #0003",
+		"        HCF                             ; #0005",
+		"        DATA -1                         ; #0006",
+		"L0007:  JEZ  [9], L0003                 ; #0007",
+		"        HCF                             ; #0010",
+	}
+	assert.Equal(t, strings.Join(expected, "\n"), d.String())
+}
+
+func TestDisassembleEntryPoints(t *testing.T) {
+	program := "99,104,5,99"
+
+	d, err := Disassemble(program)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0}, d.Code())
+
+	d, err = Disassemble(program, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 3}, d.Code())
+}
+
+func TestDisassembleMachine(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,2,3,7,99"))
+	m.Run(false)
+
+	d := m.Disassemble()
+	assert.Equal(t, []int{0, 4}, d.Code())
+	assert.Equal(t, "DATA", d.Lines[2].Mnemonic)
+	assert.Equal(t, []int{0, 0}, d.Lines[2].Values)
+	assert.Equal(t, "D0007", d.Lines[3].Label)
+	assert.Equal(t, []int{5}, d.Lines[3].Values)
+}
+
+func TestDisassembleRoundTrip(t *testing.T) {
+	programs := map[string]string{
+		"ARB":        "109,1,204,-1,1001,100,1,100,1008,100,16,101,1006,101,0,99",
+		"Compare":    "3,21,1008,21,8,20,1005,20,22,107,8,21,20,1006,20,31,1106,0,36,98,0,0,1002,21,125,20,4,20,1105,1,46,104,999,1105,1,46,1101,1000,1,20,4,20,1105,1,46,98,99",
+		"Non-canon":  "10099,1101,1,1,0,99,3,1",
+		"Truncated":  "1,0,0",
+		"Write imm":  "11101,1,1,1,99",
+		"Bad modes":  "301,1,1,1,99",
+		"Self jump":  "1105,1,0",
+		"Big values": "104,1125899906842624,99",
+	}
+	for _, day := range []string{"day09", "day13", "day17", "day25"} {
+		raw, err := ioutil.ReadFile("../../" + day + "/input.txt")
+		if err != nil {
+			continue
+		}
+		programs[day] = strings.TrimSpace(string(raw))
+	}
+
+	for name, program := range programs {
+		t.Run(fmt.Sprintf("Round trip %s", name), func(t *testing.T) {
+			d, err := Disassemble(program)
+			assert.NoError(t, err)
+
+			reassembled, err := Assemble(d.String())
+			assert.NoError(t, err)
+			assert.Equal(t, program, reassembled)
+		})
+	}
+}
+
+func TestDisassembleSegments(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,1,1,4096,1101,3,4,100,1105,1,15,0,0,0,0,99"))
+	m.Run(false)
+
+	text := m.Disassemble().String()
+	assert.Equal(t, strings.Join([]string{
+		"        ADD  1, 1, [D4096]              ; #0000",
+		"        ADD  3, 4, [D0100]              ; #0004",
+		"        JNZ  1, L0015                   ; #0008",
+		"        DATA 0, 0, 0, 0                 ; #0011",
+		"L0015:  HCF                             ; #0015",
+		"        ORG  100",
+		"D0100:  DATA 7                          ; #0100",
+		"        ORG  4096",
+		"D4096:  DATA 2                          ; #4096",
+	}, "\n"), text)
+
+	program, err := Assemble(text)
+	assert.NoError(t, err)
+	reassembled := NewMachine(M19(nil, nil))
+	assert.NoError(t, reassembled.LoadProgram(program))
+	assert.True(t, m.ramImage().equal(reassembled.ramImage()))
+
+	far := NewMachine(M19(nil, nil))
+	assert.NoError(t, far.LoadProgram("1101,1,1,1099511627776,99"))
+	far.Run(false)
+	text = far.Disassemble().String()
+	assert.True(t, strings.HasSuffix(text, "\nD1099511627776:DATA 2                   ; #1099511627776"), text)
+	_, err = Assemble(text)
+	assert.EqualError(t, err, "line 3: origin 1099511627776 is beyond the limit of 1048576")
+}
@@ -0,0 +1,97 @@
+package intcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidOpcode indicates an instruction with an unknown opcode
+	ErrInvalidOpcode = errors.New("Invalid opcode")
+
+	// ErrInvalidMode indicates a parameter with an unsupported mode
+	ErrInvalidMode = errors.New("Unsupported parameter mode")
+
+	// ErrImmediateWrite indicates an instruction writing to an immediate mode parameter
+	ErrImmediateWrite = errors.New("Write to immediate mode parameter")
+
+	// ErrNegativeAddress indicates an attempt to execute or access a negative address
+	ErrNegativeAddress = errors.New("Negative address")
+
+	// ErrOverflow indicates a value which does not fit in an int
+	ErrOverflow = errors.New("Integer overflow")
+
+	// ErrSelfModify indicates a write to previously executed code, with SelfModifyError
+	ErrSelfModify = errors.New("Write to executed code")
+)
+
+// ExecError describes an instruction the machine was unable to execute
+type ExecError struct {
+	// Err is the underlying cause, e.g. ErrInvalidOpcode
+	Err error
+	// Address is the location of the instruction
+	Address int
+	// Opcode is the raw value of the instruction, including parameter modes
+	Opcode int
+	// Param is the offending parameter (counting from 1), or 0 if the instruction itself is at fault
+	Param int
+	// Mode is the mode digit of the offending parameter, or -1 if not applicable
+	Mode int
+	// InstructionCount is the number of the failed instruction (counting from 1)
+	InstructionCount int
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("%v at %v (opcode %d", e.Err, address(e.Address), e.Opcode)
+	if e.Param > 0 {
+		msg += fmt.Sprintf(", parameter %d", e.Param)
+	}
+	if e.Mode >= 0 {
+		msg += fmt.Sprintf(", mode %d", e.Mode)
+	}
+	return msg + fmt.Sprintf(", instruction %d)", e.InstructionCount)
+}
+
+// Unwrap returns the underlying cause of the error
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError describes a program which could not be parsed
+type ParseError struct {
+	// Position is the index of the invalid value
+	Position int
+	// Token is the text of the invalid value
+	Token string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Cannot parse program: Invalid value at position %d: %v", e.Position, e.Err)
+}
+
+// Unwrap returns the underlying cause of the error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// PanicOnError makes Step, Run, Save and Restore panic when they fail, rather than only reporting
+// the error through Err and the Try* variants
+func PanicOnError() MachineOption {
+	return func(m *Machine) {
+		m.panicOnError = true
+	}
+}
+
+// Err returns the error which stopped the last instruction executed, if any
+func (m *Machine) Err() error {
+	return m.err
+}
+
+// fail panics with err if the machine was configured to do so, otherwise returning it
+func (m *Machine) fail(err error) error {
+	if m.panicOnError {
+		panic(err)
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package intcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecErrors(t *testing.T) {
+	type testDef struct {
+		program  string
+		steps    int
+		expected ExecError
+	}
+	tests := []testDef{
+		{"42", 0, ExecError{Err: ErrInvalidOpcode, Address: 0, Opcode: 42, Mode: -1, InstructionCount: 1}},
+		{"301,0,0,0,99", 0, ExecError{Err: ErrInvalidMode, Address: 0, Opcode: 301, Param: 1, Mode: 3, InstructionCount: 1}},
+		{"11101,1,1,5,99,0", 0, ExecError{Err: ErrImmediateWrite, Address: 0, Opcode: 11101, Param: 3, Mode: 1, InstructionCount: 1}},
+		{"1,-1,0,0,99", 0, ExecError{Err: ErrNegativeAddress, Address: 0, Opcode: 1, Param: 1, Mode: 0, InstructionCount: 1}},
+		{"109,-5,22201,0,0,0,99", 1, ExecError{Err: ErrNegativeAddress, Address: 2, Opcode: 22201, Param: 1, Mode: 2, InstructionCount: 2}},
+		{"1105,1,-3", 1, ExecError{Err: ErrNegativeAddress, Address: -3, Opcode: 0, Mode: -1, InstructionCount: 2}},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			m := NewMachine(M19(nil, nil))
+			assert.NoError(t, m.LoadProgram(test.program))
+			for i := 0; i < test.steps; i++ {
+				rc, err := m.TryStep()
+				assert.NoError(t, err)
+				assert.NotEqual(t, ExecRCInvalidInstruction, rc)
+			}
+			ram := m.ram.String()
+			ip := m.Register(RegisterInstructionPointer)
+
+			rc, err := m.TryRun(false)
+			assert.Equal(t, ExecRCInvalidInstruction, rc)
+			var execErr *ExecError
+			if assert.True(t, errors.As(err, &execErr)) {
+				assert.Equal(t, test.expected, *execErr)
+			}
+			assert.True(t, errors.Is(err, test.expected.Err))
+			assert.Equal(t, err, m.Err())
+
+			// The failed instruction has no effect
+			assert.Equal(t, ram, m.ram.String())
+			assert.Equal(t, ip, m.Register(RegisterInstructionPointer))
+			assert.Equal(t, test.steps, m.instructionCount)
+		})
+	}
+}
+
+func TestExecErrorString(t *testing.T) {
+	err := &ExecError{Err: ErrImmediateWrite, Address: 12, Opcode: 11101, Param: 3, Mode: 1, InstructionCount: 7}
+	assert.EqualError(t, err, "Write to immediate mode parameter at #0012 (opcode 11101, parameter 3, mode 1, instruction 7)")
+	err = &ExecError{Err: ErrInvalidOpcode, Address: 0, Opcode: 42, Mode: -1, InstructionCount: 1}
+	assert.EqualError(t, err, "Invalid opcode at #0000 (opcode 42, instruction 1)")
+}
+
+func TestParseError(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	err := m.LoadProgram("1,2, x ,4")
+	var parseErr *ParseError
+	if assert.True(t, errors.As(err, &parseErr)) {
+		assert.Equal(t, 2, parseErr.Position)
+		assert.Equal(t, "x", parseErr.Token)
+	}
+}
+
+func TestPanicOnError(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1,0,0,0,42"))
+	assert.NotPanics(t, func() { m.Run(false) })
+	assert.Error(t, m.Err())
+
+	m = NewMachine(M19(nil, nil), PanicOnError())
+	assert.NoError(t, m.LoadProgram("1,0,0,0,42"))
+	assert.Panics(t, func() { m.Run(false) })
+	assert.Panics(t, func() { m.Restore([]byte("garbage")) })
+}
+
+func TestRestoreErrors(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,1,2,5,99,0"))
+	saved, err := m.TrySave()
+	assert.NoError(t, err)
+	m.Run(false)
+
+	assert.Error(t, m.TryRestore([]byte("garbage")))
+	assert.Equal(t, 3, m.ReadRAM(5))
+	assert.NoError(t, m.TryRestore(saved))
+	assert.Equal(t, 0, m.ReadRAM(5))
+}
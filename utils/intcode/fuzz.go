@@ -0,0 +1,311 @@
+package intcode
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// FuzzFailureKind classifies how a fuzzed run failed
+type FuzzFailureKind int
+
+const (
+	// FuzzInvalidInstruction runs stopped at an instruction which could not be executed
+	FuzzInvalidInstruction FuzzFailureKind = iota
+	// FuzzOutOfRange runs accessed a negative address or one beyond the fuzzer's MaxAddress
+	FuzzOutOfRange
+	// FuzzHang runs were still executing after the fuzzer's MaxSteps instructions
+	FuzzHang
+	// FuzzPanic runs panicked within the machine
+	FuzzPanic
+)
+
+func (k FuzzFailureKind) String() string {
+	switch k {
+	case FuzzInvalidInstruction:
+		return "invalid instruction"
+	case FuzzOutOfRange:
+		return "out of range"
+	case FuzzHang:
+		return "hang"
+	case FuzzPanic:
+		return "panic"
+	}
+	return fmt.Sprintf("FuzzFailureKind(%d)", int(k))
+}
+
+// FuzzFailure describes a run which failed
+type FuzzFailure struct {
+	Kind FuzzFailureKind
+	// Address is the instruction pointer when the run failed
+	Address int
+	// Err is the error which stopped the run, if any
+	Err error
+	// Input lists the values input before the run failed
+	Input []int
+}
+
+func (f FuzzFailure) String() string {
+	msg := fmt.Sprintf("%v at %v with input %v", f.Kind, address(f.Address), f.Input)
+	if f.Err != nil {
+		msg += ": " + f.Err.Error()
+	}
+	return msg
+}
+
+// Fuzzer searches for input sequences which make a program fail, keeping inputs which reach new
+// addresses to mutate further
+type Fuzzer struct {
+	// MaxSteps is the number of instructions after which a run is considered to hang
+	MaxSteps int
+	// MaxAddress is the highest address a run may access
+	MaxAddress int
+	// MaxInputs limits the length of generated input sequences
+	MaxInputs int
+	// Rand is the source of mutations, seeded with 1 by default so that fuzzing is repeatable
+	Rand *rand.Rand
+
+	base     Machine
+	model    Model
+	corpus   [][]int
+	covered  map[address]bool
+	failures map[fuzzFailureKey]bool
+}
+
+type fuzzFailureKey struct {
+	kind FuzzFailureKind
+	ip   int
+}
+
+// NewFuzzer loads a program to fuzz into a machine of the given model, with any extra options
+func NewFuzzer(model Model, program string, options ...MachineOption) (*Fuzzer, error) {
+	f := &Fuzzer{
+		MaxSteps:   100000,
+		MaxAddress: 1 << 20,
+		MaxInputs:  256,
+		Rand:       rand.New(rand.NewSource(1)),
+		base:       NewMachine(append([]MachineOption{WithModel(model, nil, nil)}, options...)...),
+		model:      model,
+		covered:    map[address]bool{},
+		failures:   map[fuzzFailureKey]bool{},
+	}
+	if err := f.base.LoadProgram(program); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// AddSeed adds an input sequence to the corpus of inputs to mutate
+func (f *Fuzzer) AddSeed(inputs ...int) {
+	f.corpus = append(f.corpus, append([]int{}, inputs...))
+}
+
+// Corpus returns the inputs kept for mutation
+func (f *Fuzzer) Corpus() [][]int {
+	corpus := make([][]int, len(f.corpus))
+	for i, inputs := range f.corpus {
+		corpus[i] = append([]int{}, inputs...)
+	}
+	return corpus
+}
+
+// Covered returns the number of addresses executed by any run so far
+func (f *Fuzzer) Covered() int {
+	return len(f.covered)
+}
+
+// Fuzz runs the program with a number of mutated inputs, returning minimised failures which have
+// not been found before
+//
+// Failures are distinguished by their kind and address.
+func (f *Fuzzer) Fuzz(iterations int) []FuzzFailure {
+	if len(f.corpus) == 0 {
+		f.AddSeed()
+	}
+	found := []FuzzFailure{}
+	for i := 0; i < iterations; i++ {
+		inputs := f.corpus[f.Rand.Intn(len(f.corpus))]
+		for mutations := 1 + f.Rand.Intn(3); mutations > 0; mutations-- {
+			inputs = f.mutate(inputs)
+		}
+		failure, newCoverage := f.check(inputs)
+		if newCoverage {
+			f.corpus = append(f.corpus, inputs)
+		}
+		if failure == nil {
+			continue
+		}
+		key := fuzzFailureKey{failure.Kind, failure.Address}
+		if f.failures[key] {
+			continue
+		}
+		f.failures[key] = true
+		found = append(found, *f.Minimise(failure))
+	}
+	return found
+}
+
+// fuzzValues are values more likely than most to reach unusual behaviour
+var fuzzValues = []int{0, 1, -1, 2, 10, 32, 127, 128, 255, 256, 1<<31 - 1, -1 << 31, 1 << 62, minInt}
+
+// mutate returns a copy of inputs with one random change
+func (f *Fuzzer) mutate(inputs []int) []int {
+	mutated := append([]int{}, inputs...)
+	value := func() int {
+		switch f.Rand.Intn(4) {
+		case 0:
+			return fuzzValues[f.Rand.Intn(len(fuzzValues))]
+		case 1:
+			return 32 + f.Rand.Intn(95)
+		case 2:
+			return f.Rand.Intn(256)
+		}
+		return f.Rand.Intn(2001) - 1000
+	}
+	pos := 0
+	if len(mutated) > 0 {
+		pos = f.Rand.Intn(len(mutated))
+	}
+	switch f.Rand.Intn(5) {
+	case 0:
+		if len(mutated) > 0 {
+			mutated[pos] = value()
+			break
+		}
+		fallthrough
+	case 1:
+		mutated = append(mutated[:pos], append([]int{value()}, mutated[pos:]...)...)
+	case 2:
+		if len(mutated) > 0 {
+			mutated = append(mutated[:pos], mutated[pos+1:]...)
+		}
+	case 3:
+		end := pos + f.Rand.Intn(len(mutated)-pos+1)
+		mutated = append(mutated[:end], append(append([]int{}, mutated[pos:end]...), mutated[end:]...)...)
+	case 4:
+		other := f.corpus[f.Rand.Intn(len(f.corpus))]
+		mutated = append(mutated[:pos], other[f.Rand.Intn(len(other)+1):]...)
+	}
+	if len(mutated) > f.MaxInputs {
+		mutated = mutated[:f.MaxInputs]
+	}
+	return mutated
+}
+
+// Check runs the program with a sequence of inputs, returning how it failed or nil if it halted or
+// ran out of input
+func (f *Fuzzer) Check(inputs []int) *FuzzFailure {
+	failure, _ := f.check(inputs)
+	return failure
+}
+
+// Minimise searches for the shortest and simplest input which fails in the same way
+func (f *Fuzzer) Minimise(failure *FuzzFailure) *FuzzFailure {
+	same := func(inputs []int) *FuzzFailure {
+		if candidate := f.Check(inputs); candidate != nil && candidate.Kind == failure.Kind && candidate.Address == failure.Address {
+			return candidate
+		}
+		return nil
+	}
+	best := failure
+	for chunk := len(best.Input) / 2; chunk >= 1; chunk /= 2 {
+		for start := 0; start+chunk <= len(best.Input); {
+			inputs := append(append([]int{}, best.Input[:start]...), best.Input[start+chunk:]...)
+			if candidate := same(inputs); candidate != nil {
+				best = candidate
+			} else {
+				start += chunk
+			}
+		}
+	}
+	for i := range best.Input {
+		if best.Input[i] == 0 {
+			continue
+		}
+		inputs := append([]int{}, best.Input...)
+		inputs[i] = 0
+		if candidate := same(inputs); candidate != nil {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// fuzzHook records the addresses executed by a run and stops it at any out of range access
+type fuzzHook struct {
+	nopHook
+	maxAddress address
+	executed   []address
+	outOfRange *address
+}
+
+func (h *fuzzHook) beforeStep(ip address, op operation) {
+	h.executed = append(h.executed, ip)
+	h.check(ip)
+}
+
+func (h *fuzzHook) memoryRead(addr address, value int)            { h.check(addr) }
+func (h *fuzzHook) memoryWrite(addr address, previous, value int) { h.check(addr) }
+
+func (h *fuzzHook) check(addr address) {
+	if addr > h.maxAddress && h.outOfRange == nil {
+		h.outOfRange = &addr
+	}
+}
+
+// check runs the program with a sequence of inputs, reporting whether it executed any address
+// not executed by an earlier run
+func (f *Fuzzer) check(inputs []int) (failure *FuzzFailure, newCoverage bool) {
+	consumed := 0
+	inputCB := func() (int, bool) {
+		if consumed == len(inputs) {
+			return 0, true
+		}
+		consumed++
+		return inputs[consumed-1], false
+	}
+	m := f.base.Clone(WithModel(f.model, inputCB, nil))
+	hook := &fuzzHook{maxAddress: address(f.MaxAddress)}
+	m.addHook(hook)
+	fail := func(kind FuzzFailureKind, err error) {
+		failure = &FuzzFailure{
+			Kind:    kind,
+			Address: m.Register(RegisterInstructionPointer),
+			Err:     err,
+			Input:   append([]int{}, inputs[:consumed]...),
+		}
+	}
+
+	defer func() {
+		for _, addr := range hook.executed {
+			if !f.covered[addr] {
+				f.covered[addr] = true
+				newCoverage = true
+			}
+		}
+		if r := recover(); r != nil {
+			fail(FuzzPanic, fmt.Errorf("%v", r))
+		}
+	}()
+	for step := 0; step < f.MaxSteps; step++ {
+		ip := m.Register(RegisterInstructionPointer)
+		rc, err := m.TryStep()
+		if hook.outOfRange != nil {
+			fail(FuzzOutOfRange, fmt.Errorf("Access to %v beyond %v", *hook.outOfRange, address(f.MaxAddress)))
+			failure.Address = ip
+			return
+		}
+		switch {
+		case errors.Is(err, ErrNegativeAddress):
+			fail(FuzzOutOfRange, err)
+			return
+		case err != nil || rc == ExecRCInvalidInstruction:
+			fail(FuzzInvalidInstruction, err)
+			return
+		case rc == ExecRCHCF || rc == ExecRCNeedInput:
+			return
+		}
+	}
+	fail(FuzzHang, nil)
+	return
+}
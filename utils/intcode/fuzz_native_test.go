@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package intcode
+
+import (
+	"testing"
+)
+
+// FuzzMachine loads arbitrary programs and runs them with arbitrary input, looking for panics in
+// the machine itself
+//
+// Run with: go test -fuzz=FuzzMachine ./utils/intcode
+func FuzzMachine(f *testing.F) {
+	f.Add("1,0,0,0,99", []byte{})
+	f.Add("3,9,8,9,10,9,4,9,99,-1,8", []byte{8})
+	f.Add("109,1,204,-1,1001,100,1,100,1008,100,16,101,1006,101,0,99", []byte{})
+	f.Add("3,3,1105,-1,9,1101,0,0,12,4,12,99,1", []byte{0, 1})
+	f.Fuzz(func(t *testing.T, program string, input []byte) {
+		fuzzer, err := NewFuzzer(M19Model, program)
+		if err != nil {
+			return
+		}
+		fuzzer.MaxSteps = 10000
+		fuzzer.MaxAddress = 1 << 16
+		inputs := make([]int, len(input))
+		for i, value := range input {
+			inputs[i] = int(int8(value))
+		}
+		if failure := fuzzer.Check(inputs); failure != nil && failure.Kind == FuzzPanic {
+			t.Fatal(failure)
+		}
+	})
+}
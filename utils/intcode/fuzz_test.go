@@ -0,0 +1,92 @@
+package intcode
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fuzzTestSource reads values until a zero, failing on 42, hanging on 7 and writing far beyond
+// its memory on 13
+const fuzzTestSource = `
+	loop:   INP  [value]
+	        JEZ  [value], done
+	        CEQ  [value], 42, [t]
+	        JNZ  [t], crash
+	        CEQ  [value], 7, [t]
+	        JNZ  [t], hang
+	        CEQ  [value], 13, [t]
+	        JNZ  [t], far
+	        JNZ  1, loop
+	done:   HCF
+	crash:  DATA 77
+	hang:   JNZ  1, hang
+	far:    ADD  1, 1, [2000000]
+	        HCF
+	value:  DATA 0
+	t:      DATA 0
+`
+
+func TestFuzzerCheck(t *testing.T) {
+	program, err := Assemble(fuzzTestSource)
+	assert.NoError(t, err)
+	f, err := NewFuzzer(M19Model, program)
+	assert.NoError(t, err)
+	f.MaxSteps = 1000
+
+	assert.Nil(t, f.Check([]int{1, 2}))
+	assert.Nil(t, f.Check([]int{5, 0, 42}))
+
+	failure := f.Check([]int{5, 3, 42, 9})
+	if assert.NotNil(t, failure) {
+		assert.Equal(t, FuzzInvalidInstruction, failure.Kind)
+		assert.Equal(t, 30, failure.Address)
+		assert.Equal(t, []int{5, 3, 42}, failure.Input)
+		assert.True(t, errors.Is(failure.Err, ErrInvalidOpcode))
+		assert.Equal(t, []int{42}, f.Minimise(failure).Input)
+	}
+
+	failure = f.Check([]int{7})
+	if assert.NotNil(t, failure) {
+		assert.Equal(t, FuzzHang, failure.Kind)
+		assert.Equal(t, "hang at #0031 with input [7]", failure.String())
+	}
+
+	failure = f.Check([]int{13})
+	if assert.NotNil(t, failure) {
+		assert.Equal(t, FuzzOutOfRange, failure.Kind)
+		assert.Equal(t, 34, failure.Address)
+		assert.EqualError(t, failure.Err, "Access to #2000000 beyond #1048576")
+	}
+
+	negative, err := NewFuzzer(M19Model, "3,5,1005,5,-1,99")
+	assert.NoError(t, err)
+	failure = negative.Check([]int{1})
+	if assert.NotNil(t, failure) {
+		assert.Equal(t, FuzzOutOfRange, failure.Kind)
+		assert.True(t, errors.Is(failure.Err, ErrNegativeAddress))
+	}
+}
+
+func TestFuzzer(t *testing.T) {
+	program, err := Assemble(fuzzTestSource)
+	assert.NoError(t, err)
+	f, err := NewFuzzer(M19Model, program, DenseMemory())
+	assert.NoError(t, err)
+	f.MaxSteps = 1000
+	f.AddSeed(1, 2, 3)
+
+	failures := f.Fuzz(5000)
+	inputs := map[FuzzFailureKind][]int{}
+	for _, failure := range failures {
+		inputs[failure.Kind] = failure.Input
+	}
+	assert.Equal(t, map[FuzzFailureKind][]int{
+		FuzzInvalidInstruction: {42},
+		FuzzHang:               {7},
+		FuzzOutOfRange:         {13},
+	}, inputs)
+	assert.Equal(t, 13, f.Covered())
+	assert.Empty(t, f.Fuzz(100))
+}
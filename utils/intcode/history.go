@@ -0,0 +1,310 @@
+package intcode
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// History records undo information as the machine executes, allowing it to be stepped backwards
+//
+// The most recent window instructions are undone directly. Older states are recovered by restoring
+// a checkpoint, taken with Snapshot every checkpointInterval instructions, and re-executing forwards
+// with the inputs originally received. At most maxCheckpoints checkpoints are kept.
+//
+// While re-executing previously executed instructions, recorded inputs are replayed and outputs are
+// not passed to the output callback.
+func History(window, checkpointInterval, maxCheckpoints int) MachineOption {
+	return func(m *Machine) {
+		h := &history{
+			machine:        m,
+			window:         window,
+			interval:       checkpointInterval,
+			maxCheckpoints: maxCheckpoints,
+			inputs:         map[int]int{},
+		}
+		m.history = h
+		m.addHook(h)
+	}
+}
+
+// StepBack undoes the last n executed instructions
+func (m *Machine) StepBack(n int) error {
+	return m.RewindTo(m.instructionCount - n)
+}
+
+// RewindTo returns the machine to the state it was in after count instructions had executed
+func (m *Machine) RewindTo(count int) error {
+	if m.history == nil {
+		return fmt.Errorf("Cannot rewind: machine has no history")
+	}
+	if count < 0 || count > m.instructionCount {
+		return fmt.Errorf("Cannot rewind to instruction %d from %d", count, m.instructionCount)
+	}
+	return m.history.seek(count)
+}
+
+// RunBackToWrite rewinds to just before the most recent instruction that wrote to addr
+func (m *Machine) RunBackToWrite(addr int) error {
+	if m.history == nil {
+		return fmt.Errorf("Cannot rewind: machine has no history")
+	}
+	count, found := m.history.lastWrite(address(addr))
+	if !found {
+		return fmt.Errorf("No write to %v found in history", address(addr))
+	}
+	return m.history.seek(count - 1)
+}
+
+type history struct {
+	nopHook
+	machine *Machine
+
+	window         int
+	interval       int
+	maxCheckpoints int
+
+	undo        []undoRecord
+	current     undoRecord
+	recording   bool
+	checkpoints []historyCheckpoint
+	inputs      map[int]int
+	liveCount   int
+}
+
+type undoRecord struct {
+	count     int
+	registers registerList
+	writes    []undoWrite
+}
+
+type undoWrite struct {
+	addr     address
+	previous int
+	existed  bool
+	// previousBig is the exact previous value, if it had been promoted
+	previousBig *big.Int
+}
+
+type historyCheckpoint struct {
+	count int
+	state *Snapshot
+}
+
+func (h *history) beforeStep(ip address, op operation) {
+	h.recording = op != nil
+	if !h.recording {
+		return
+	}
+	count := h.machine.instructionCount
+	if h.interval > 0 && count%h.interval == 0 &&
+		(len(h.checkpoints) == 0 || h.checkpoints[len(h.checkpoints)-1].count < count) {
+		h.checkpoints = append(h.checkpoints, historyCheckpoint{count, h.machine.Snapshot()})
+		if len(h.checkpoints) > h.maxCheckpoints {
+			h.checkpoints = h.checkpoints[len(h.checkpoints)-h.maxCheckpoints:]
+			h.trimInputs()
+		}
+	}
+
+	registers := registerList{}
+	for reg, value := range h.machine.registers {
+		registers[reg] = value
+	}
+	h.current = undoRecord{
+		count:     count + 1,
+		registers: registers,
+	}
+}
+
+func (h *history) memoryWrite(addr address, previous, value int) {
+	// Device writes cannot be undone, so are left out of the undo log
+	if _, mapped := h.machine.device(addr); h.recording && !mapped {
+		_, existed := h.machine.ram.read(addr)
+		h.current.writes = append(h.current.writes, undoWrite{addr, previous, existed, h.machine.bigValues[addr]})
+	}
+}
+
+func (h *history) inputReceived(value int) {
+	h.inputs[h.machine.instructionCount] = value
+}
+
+func (h *history) afterStep(rc ExecReturnCode) {
+	if !h.recording {
+		return
+	}
+	h.recording = false
+	if rc == ExecRCInvalidInstruction || rc == ExecRCNeedInput {
+		// Failed and waiting instructions leave the machine unchanged
+		return
+	}
+	h.undo = append(h.undo, h.current)
+	if len(h.undo) > h.window {
+		h.undo = h.undo[len(h.undo)-h.window:]
+		h.trimInputs()
+	}
+	if h.machine.instructionCount > h.liveCount {
+		h.liveCount = h.machine.instructionCount
+	}
+}
+
+// trimInputs discards recorded inputs which can no longer be replayed
+func (h *history) trimInputs() {
+	oldest := h.machine.instructionCount
+	if len(h.undo) > 0 && h.undo[0].count-1 < oldest {
+		oldest = h.undo[0].count - 1
+	}
+	if len(h.checkpoints) > 0 && h.checkpoints[0].count < oldest {
+		oldest = h.checkpoints[0].count
+	}
+	for count := range h.inputs {
+		if count <= oldest {
+			delete(h.inputs, count)
+		}
+	}
+}
+
+func (h *history) replaying(count int) bool {
+	return h != nil && count <= h.liveCount
+}
+
+func (h *history) replayInput(count int) (int, bool) {
+	if !h.replaying(count) {
+		return 0, false
+	}
+	value, found := h.inputs[count]
+	return value, found
+}
+
+// seek moves the machine to any previously executed instruction count
+func (h *history) seek(count int) error {
+	m := h.machine
+	for m.instructionCount > count && len(h.undo) > 0 {
+		h.undoLast()
+	}
+	if m.instructionCount > count {
+		idx := sort.Search(len(h.checkpoints), func(i int) bool { return h.checkpoints[i].count > count }) - 1
+		if idx < 0 {
+			return fmt.Errorf("History for instruction %d is no longer available", count)
+		}
+		h.restoreCheckpoint(h.checkpoints[idx])
+	}
+
+	// Other hooks saw these instructions when they first executed, so only the history and any
+	// writeWatcher observe them being replayed
+	hooks := m.hooks
+	defer func() { m.hooks = hooks }()
+	m.hooks = nil
+	for _, hook := range hooks {
+		switch hook.(type) {
+		case *history, *writeWatcher:
+			m.hooks = append(m.hooks, hook)
+		}
+	}
+	for m.instructionCount < count {
+		rc := m.Step()
+		if rc != ExecRCNone && rc != ExecRCInterrupt && m.instructionCount < count {
+			return fmt.Errorf("Machine stopped at instruction %d while replaying to %d", m.instructionCount, count)
+		}
+	}
+	return nil
+}
+
+func (h *history) undoLast() {
+	m := h.machine
+	record := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+
+	for i := len(record.writes) - 1; i >= 0; i-- {
+		write := record.writes[i]
+		if write.existed {
+			m.ram.write(write.addr, write.previous)
+		} else {
+			m.ram.clear(write.addr)
+		}
+		delete(m.operations, write.addr)
+		delete(m.bigValues, write.addr)
+		if write.previousBig != nil {
+			m.setBig(write.addr, write.previousBig)
+		}
+	}
+	for reg := range m.registers {
+		delete(m.registers, reg)
+	}
+	for reg, value := range record.registers {
+		m.registers[reg] = value
+	}
+	m.instructionCount = record.count - 1
+}
+
+func (h *history) restoreCheckpoint(checkpoint historyCheckpoint) {
+	m := h.machine
+	queue, executed, codeWrites := m.inputQueue, m.executed, m.codeWrites
+	m.restoreSnapshot(checkpoint.state)
+	m.inputQueue, m.executed, m.codeWrites = queue, executed, codeWrites
+	h.undo = h.undo[:0]
+}
+
+// reset forgets all history, e.g. once the machine is restored to an unrelated state
+func (h *history) reset() {
+	if h == nil {
+		return
+	}
+	h.undo = nil
+	h.current = undoRecord{}
+	h.recording = false
+	h.checkpoints = nil
+	h.inputs = map[int]int{}
+	h.liveCount = h.machine.instructionCount
+}
+
+// lastWrite finds the most recent instruction, up to the current one, which wrote to addr
+func (h *history) lastWrite(addr address) (int, bool) {
+	for i := len(h.undo) - 1; i >= 0; i-- {
+		for _, write := range h.undo[i].writes {
+			if write.addr == addr {
+				return h.undo[i].count, true
+			}
+		}
+	}
+
+	present := h.machine.instructionCount
+	searchEnd := present
+	if len(h.undo) > 0 {
+		searchEnd = h.undo[0].count - 1
+	}
+	watcher := &writeWatcher{machine: h.machine, addr: addr}
+	for i := len(h.checkpoints) - 1; i >= 0; i-- {
+		checkpoint := h.checkpoints[i]
+		if checkpoint.count >= searchEnd {
+			continue
+		}
+		h.restoreCheckpoint(checkpoint)
+		h.machine.addHook(watcher)
+		err := h.seek(searchEnd)
+		h.machine.removeHook(watcher)
+		if err != nil {
+			break
+		}
+		if watcher.found {
+			return watcher.count, true
+		}
+		searchEnd = checkpoint.count
+	}
+	h.seek(present)
+	return 0, false
+}
+
+type writeWatcher struct {
+	nopHook
+	machine *Machine
+	addr    address
+	count   int
+	found   bool
+}
+
+func (w *writeWatcher) memoryWrite(addr address, previous, value int) {
+	if addr == w.addr {
+		w.found = true
+		w.count = w.machine.instructionCount
+	}
+}
@@ -0,0 +1,159 @@
+package intcode
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// historyTestSource echoes inputs multiplied by an increasing factor until a zero is read
+const historyTestSource = `
+	loop:  INP  [value]
+	       JEZ  [value], end
+	       ADD  [factor], 1, [factor]
+	       MUL  [value], [factor], [rb+50]
+	       ARB  1
+	       OUT  [rb+49]
+	       JNZ  1, loop
+	end:   HCF
+	value:  DATA 0
+	factor: DATA 0
+`
+
+func newHistoryTestMachine(t *testing.T, options ...MachineOption) (*Machine, *[]int, *[]int) {
+	program, err := Assemble(historyTestSource)
+	assert.NoError(t, err)
+
+	inputs := []int{}
+	outputs := []int{}
+	inputCB := func() (int, bool) {
+		next := len(inputs) + 1
+		if next > 20 {
+			next = 0
+		}
+		inputs = append(inputs, next)
+		return next, false
+	}
+	outputCB := func(out int) {
+		outputs = append(outputs, out)
+	}
+	m := NewMachine(append([]MachineOption{M19(inputCB, outputCB)}, options...)...)
+	assert.NoError(t, m.LoadProgram(program))
+	return &m, &inputs, &outputs
+}
+
+func historyTestState(m *Machine) string {
+	return fmt.Sprintf("%d|%v|%v", m.instructionCount, m.registers, m.ram)
+}
+
+func TestHistoryStepBack(t *testing.T) {
+	for _, window := range []int{1000, 5} {
+		t.Run(fmt.Sprintf("Window %d", window), func(t *testing.T) {
+			m, inputs, outputs := newHistoryTestMachine(t, History(window, 10, 100))
+
+			states := []string{historyTestState(m)}
+			for i := 0; i < 60; i++ {
+				m.Step()
+				states = append(states, historyTestState(m))
+			}
+			inputCount, outputCount := len(*inputs), len(*outputs)
+
+			assert.NoError(t, m.StepBack(1))
+			assert.Equal(t, states[59], historyTestState(m))
+			assert.NoError(t, m.StepBack(3))
+			assert.Equal(t, states[56], historyTestState(m))
+			assert.NoError(t, m.RewindTo(7))
+			assert.Equal(t, states[7], historyTestState(m))
+			assert.NoError(t, m.RewindTo(0))
+			assert.Equal(t, states[0], historyTestState(m))
+
+			// Re-executing replays the original inputs without repeating outputs
+			for i := 1; i <= 60; i++ {
+				m.Step()
+				assert.Equal(t, states[i], historyTestState(m))
+			}
+			assert.Equal(t, inputCount, len(*inputs))
+			assert.Equal(t, outputCount, len(*outputs))
+
+			// Execution then continues live
+			m.Run(false)
+			assert.Equal(t, []int{1, 4, 9, 16, 25, 36, 49, 64, 81, 100}, (*outputs)[:10])
+			assert.Len(t, *outputs, 20)
+		})
+	}
+}
+
+func TestHistoryRunBackToWrite(t *testing.T) {
+	m, _, _ := newHistoryTestMachine(t, History(3, 4, 100))
+	for i := 0; i < 40; i++ {
+		m.Step()
+	}
+	const factor = 22
+
+	assert.NoError(t, m.RunBackToWrite(factor))
+	assert.Equal(t, "#0005:\tADD\t#22 (5)\t'1'\t#22 (5)", NewDebugger(m).Current())
+	assert.Equal(t, 5, m.ReadRAM(factor))
+
+	assert.NoError(t, m.RunBackToWrite(factor))
+	assert.Equal(t, 4, m.ReadRAM(factor))
+
+	assert.Error(t, m.RunBackToWrite(1000))
+	assert.Equal(t, 4, m.ReadRAM(factor))
+}
+
+func TestHistoryReplayHooks(t *testing.T) {
+	trace := NewRingTraceSink(100)
+	m, _, _ := newHistoryTestMachine(t, History(3, 4, 100), Trace(trace))
+	for i := 0; i < 40; i++ {
+		m.Step()
+	}
+	assert.NoError(t, m.StepBack(10))
+	assert.NoError(t, m.RunBackToWrite(22))
+	records := trace.Records()
+	assert.Len(t, records, 40)
+	assert.Equal(t, 40, records[len(records)-1].Count)
+
+	m.Step()
+	records = trace.Records()
+	assert.Len(t, records, 41)
+	assert.Equal(t, m.instructionCount, records[len(records)-1].Count)
+}
+
+func TestHistoryLimits(t *testing.T) {
+	m, _, _ := newHistoryTestMachine(t)
+	m.Step()
+	assert.EqualError(t, m.StepBack(1), "Cannot rewind: machine has no history")
+
+	m, _, _ = newHistoryTestMachine(t, History(5, 10, 2))
+	for i := 0; i < 50; i++ {
+		m.Step()
+	}
+	assert.EqualError(t, m.RewindTo(51), "Cannot rewind to instruction 51 from 50")
+	assert.EqualError(t, m.RewindTo(5), "History for instruction 5 is no longer available")
+	assert.NoError(t, m.RewindTo(30))
+	assert.NoError(t, m.RewindTo(45-15))
+}
+
+func TestHistoryRestoreSnapshot(t *testing.T) {
+	m, _, _ := newHistoryTestMachine(t, History(10, 2, 100))
+	for i := 0; i < 4; i++ {
+		m.Step()
+	}
+
+	other := NewMachine(M19(nil, nil))
+	assert.NoError(t, other.LoadProgram("1101,1,1,20,1101,7,9,31,1101,1,1,32,99"))
+	other.Step()
+	other.Step()
+	assert.NoError(t, m.RestoreSnapshot(other.Snapshot()))
+
+	assert.EqualError(t, m.RewindTo(1), "History for instruction 1 is no longer available")
+	assert.Equal(t, 16, m.ReadRAM(31))
+
+	m.Step()
+	assert.Equal(t, 2, m.ReadRAM(32))
+	assert.NoError(t, m.RewindTo(2))
+	assert.Equal(t, 0, m.ReadRAM(32))
+	assert.Equal(t, 16, m.ReadRAM(31))
+	assert.Equal(t, 8, m.Register(RegisterInstructionPointer))
+}
@@ -0,0 +1,32 @@
+package intcode
+
+// executionHook observes a machine as it executes operations
+type executionHook interface {
+	beforeStep(ip address, op operation)
+	memoryRead(addr address, value int)
+	memoryWrite(addr address, previous, value int)
+	inputReceived(value int)
+	afterStep(rc ExecReturnCode)
+}
+
+// nopHook can be embedded by hooks which only need a subset of notifications
+type nopHook struct{}
+
+func (nopHook) beforeStep(ip address, op operation)           {}
+func (nopHook) memoryRead(addr address, value int)            {}
+func (nopHook) memoryWrite(addr address, previous, value int) {}
+func (nopHook) inputReceived(value int)                       {}
+func (nopHook) afterStep(rc ExecReturnCode)                   {}
+
+func (m *Machine) addHook(hook executionHook) {
+	m.hooks = append(m.hooks, hook)
+}
+
+func (m *Machine) removeHook(hook executionHook) {
+	for i, existing := range m.hooks {
+		if existing == hook {
+			m.hooks = append(m.hooks[:i:i], m.hooks[i+1:]...)
+			return
+		}
+	}
+}
@@ -2,21 +2,22 @@ package intcode
 
 import (
 	"bytes"
-	"encoding/gob"
 	"fmt"
+	"math/big"
 	"sort"
+	"strconv"
 	"strings"
 )
 
 // NewMachine creates a new intcode machine
 func NewMachine(options ...MachineOption) Machine {
-	m := Machine{
-		ram:        map[address]integer{},
+	m := Machine{&machineState{
+		ram:        ram{},
 		operations: map[address]operation{},
 		registers: registerList{
 			RegisterInstructionPointer: 0,
 		},
-	}
+	}}
 	for _, option := range options {
 		option(&m)
 	}
@@ -24,11 +25,35 @@ func NewMachine(options ...MachineOption) Machine {
 }
 
 // Machine is a virtual machine capable of running intcode (e.g. https://adventofcode.com/2019/day/2)
+//
+// Copies of a Machine refer to the same underlying state.
 type Machine struct {
-	model      model
-	ram        ram
+	*machineState
+}
+
+type machineState struct {
+	model      boundModel
+	ram        memory
 	operations operationMap
 	registers  registerList
+	hooks      []executionHook
+	history    *history
+
+	inputQueue       []int
+	instructionCount int
+	panicOnError     bool
+	err              error
+
+	overflow  OverflowMode
+	bigValues map[address]*big.Int
+	bigOutput BigOutputCallback
+
+	devices []mappedDevice
+
+	selfModify  SelfModifyMode
+	executed    map[address]address
+	codeWrites  []CodeWrite
+	stepAddress address
 }
 
 // LoadProgram wipes the machine and loads a new program from an input string
@@ -39,47 +64,144 @@ func (m *Machine) LoadProgram(program string) error {
 	return m.model.parse(program)
 }
 
+// parseProgram splits a comma separated program into its integer values
+func parseProgram(program string) ([]int, error) {
+	programIntStrings := strings.Split(strings.TrimSpace(program), ",")
+	values := make([]int, len(programIntStrings))
+	for pos, valString := range programIntStrings {
+		token := strings.TrimSpace(valString)
+		value, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, &ParseError{Position: pos, Token: token, Err: err}
+		}
+		values[pos] = value
+	}
+	return values, nil
+}
+
 // Register reads the value from a machine register
 func (m *Machine) Register(reg registerID) int {
 	return m.registers[reg]
 }
 
 // Step executes a single operation on the processor
+//
+// An instruction which cannot be executed returns ExecRCInvalidInstruction, with the cause
+// available from Err.
 func (m *Machine) Step() ExecReturnCode {
+	rc, err := m.TryStep()
+	if err != nil {
+		m.fail(err)
+	}
+	return rc
+}
+
+// TryStep executes a single operation on the processor, returning an *ExecError if it cannot be
+// executed
+//
+// A failed instruction leaves the machine unchanged, so it may be corrected and retried.
+func (m *Machine) TryStep() (ExecReturnCode, error) {
 	ip := address(m.registers[RegisterInstructionPointer])
-	op := m.model.decodeAddress(ip)
+	op := m.ram.decoded(ip)
+	var err error
 	if op == nil {
-		panic(fmt.Sprintf("Unable to decode op att address %v", ip))
+		op, err = m.decode(ip)
+		if err == nil {
+			m.operations[ip] = op
+			m.ram.cache(ip, op)
+		}
+	}
+	for _, hook := range m.hooks {
+		hook.beforeStep(ip, op)
+	}
+	var rc ExecReturnCode
+	if err == nil {
+		m.instructionCount++
+		m.stepAddress = ip
+		rc, err = op.exec()
+		if err != nil || rc == ExecRCNeedInput {
+			m.instructionCount--
+		} else if m.selfModify != SelfModifyAllow {
+			m.markExecuted(ip, op)
+		}
+	}
+	if err != nil {
+		if execErr, ok := err.(*ExecError); ok {
+			execErr.InstructionCount = m.instructionCount + 1
+		}
+		rc = ExecRCInvalidInstruction
 	}
-	m.operations[ip] = op
+	m.err = err
+	for _, hook := range m.hooks {
+		hook.afterStep(rc)
+	}
+	return rc, err
+}
 
-	return op.Exec()
+func (m *Machine) decode(ip address) (operation, error) {
+	if ip < 0 {
+		return nil, &ExecError{Err: ErrNegativeAddress, Address: int(ip), Mode: -1}
+	}
+	return m.model.decodeAddress(ip)
 }
 
 // Run runs the processor until a halt signal is hit
 func (m *Machine) Run(stopOnInterrupt bool) {
+	if _, err := m.TryRun(stopOnInterrupt); err != nil {
+		m.fail(err)
+	}
+}
+
+// TryRun runs the processor until a halt signal is hit, returning the final return code and any
+// error which stopped execution
+func (m *Machine) TryRun(stopOnInterrupt bool) (ExecReturnCode, error) {
 	for {
-		rc := m.Step()
+		rc, err := m.TryStep()
 		switch rc {
 		case ExecRCNone:
 		case ExecRCInterrupt:
 			if stopOnInterrupt {
-				return
+				return rc, nil
 			}
 		default:
-			return
+			return rc, err
 		}
 	}
 }
 
 // ReadRAM returns the value at a given address
 func (m Machine) ReadRAM(addr address) int {
-	return m.ram[addr].Value()
+	return m.readAddress(addr)
+}
+
+// Memory returns a copy of the values which have been stored in RAM, by address
+func (m Machine) Memory() map[int]int {
+	values := map[int]int{}
+	for _, addr := range m.ram.addresses() {
+		values[int(addr)] = m.readAddress(addr)
+	}
+	return values
 }
 
 // WriteRAM stores a value at a given address
 func (m Machine) WriteRAM(addr address, value int) {
-	m.ram[addr].Set(value)
+	if m.ram.write(addr, value) {
+		delete(m.operations, addr)
+	}
+	delete(m.bigValues, addr)
+}
+
+// WriteMemory stores values in RAM, by address
+func (m Machine) WriteMemory(values map[int]int) error {
+	for addr := range values {
+		if addr < 0 {
+			return fmt.Errorf("Cannot write to %v: %w", address(addr), ErrNegativeAddress)
+		}
+	}
+	for addr, value := range values {
+		m.WriteRAM(address(addr), value)
+	}
+	return nil
 }
 
 func (m Machine) String() string {
@@ -99,34 +221,18 @@ func (m Machine) String() string {
 	}
 
 	state = append(state, "Decode:")
-	opAddresses := addressList{}
-	for opAddress := range m.operations {
-		opAddresses = append(opAddresses, opAddress)
-	}
-	sort.Sort(opAddresses)
-
-	ramAddresses := addressList{}
-	for ramAddress := range m.ram {
-		ramAddresses = append(ramAddresses, ramAddress)
-	}
-	sort.Sort(ramAddresses)
-
 	lastRAMAccounted := address(-1)
-	for _, ramAddress := range ramAddresses {
+	for _, ramAddress := range m.ram.addresses() {
 		if ramAddress <= lastRAMAccounted {
 			continue
 		}
 		lastRAMAccounted = ramAddress
-		if len(opAddresses) == 0 || ramAddress < opAddresses[0] {
-			// Not an op
-			val := m.ram[ramAddress].Value()
-			state = append(state, fmt.Sprintf("\t%v:\tDATA\t%d\t(%x)", address(ramAddress), val, val))
-		} else {
-			// Is op
-			op := m.operations[ramAddress]
+		val := m.readAddress(ramAddress)
+		if op, found := m.operations[ramAddress]; found && op.Value() == val {
 			state = append(state, fmt.Sprintf("\t%v:\tOPER\t%v", address(ramAddress), op))
 			lastRAMAccounted += address(op.NumParams())
-			opAddresses = opAddresses[1:]
+		} else {
+			state = append(state, fmt.Sprintf("\t%v:\tDATA\t%d\t(%x)", address(ramAddress), val, val))
 		}
 	}
 
@@ -140,68 +246,130 @@ func (m Machine) String() string {
 	return strings.TrimSpace(stateString)
 }
 
-func (m *Machine) readAddress(addr address) integer {
-	// return m.ram[addr]
-	if value, found := m.ram[addr]; found {
-		return value
+func (m *Machine) readAddress(addr address) int {
+	value, _ := m.ram.read(addr)
+	return value
+}
+
+// loadAddress reads a value on behalf of an executing operation
+func (m *Machine) loadAddress(addr address) int {
+	value := m.readAddress(addr)
+	if len(m.devices) > 0 {
+		if mapped, found := m.device(addr); found {
+			value = mapped.device.Read(int(addr - mapped.start))
+		}
 	}
-	return &baseInteger{
-		machine: m,
-		address: addr,
+	for _, hook := range m.hooks {
+		hook.memoryRead(addr, value)
 	}
+	return value
 }
 
 func (m *Machine) writeAddress(addr address, value int) {
-	if m.ram[addr] == nil {
-		m.ram[addr] = &baseInteger{
-			machine: m,
-			address: addr,
-			Val:     value,
+	var mapped mappedDevice
+	isDevice := false
+	if len(m.devices) > 0 {
+		mapped, isDevice = m.device(addr)
+	}
+	if len(m.hooks) > 0 || m.selfModify != SelfModifyAllow {
+		// Devices are not read for their previous value, as reading may change them
+		previous := 0
+		if !isDevice {
+			previous = m.readAddress(addr)
+		}
+		for _, hook := range m.hooks {
+			hook.memoryWrite(addr, previous, value)
+		}
+		if m.selfModify != SelfModifyAllow && !isDevice {
+			m.checkCodeWrite(addr, previous, value)
 		}
-	} else {
-		m.ram[addr].Set(value)
 	}
-	delete(m.operations, addr)
-	// if _,found := m.operations[addr]; found {
-	// 	// TODO decode?
-	// }
+	if isDevice {
+		mapped.device.Write(int(addr-mapped.start), value)
+		return
+	}
+	if m.ram.write(addr, value) {
+		delete(m.operations, addr)
+	}
+	delete(m.bigValues, addr)
+}
+
+// QueueInput adds values to be read by the program before any input callback is called
+//
+// A machine without an input callback reads only queued values, returning ExecRCNeedInput when
+// the queue is empty so that more can be queued before execution is resumed.
+func (m *Machine) QueueInput(values ...int) {
+	m.inputQueue = append(m.inputQueue, values...)
+}
+
+// input retrieves the next input value for an executing operation
+//
+// The return code is ExecRCNone if a value was read, or the code with which the operation should
+// stop otherwise.
+func (m *Machine) input(callback InputCallback) (int, ExecReturnCode) {
+	value, found := m.history.replayInput(m.instructionCount)
+	switch {
+	case found:
+	case len(m.inputQueue) > 0:
+		value = m.inputQueue[0]
+		m.inputQueue = m.inputQueue[1:]
+	case callback == nil:
+		return 0, ExecRCNeedInput
+	default:
+		var halt bool
+		value, halt = callback()
+		if halt {
+			return 0, ExecRCHCF
+		}
+	}
+	for _, hook := range m.hooks {
+		hook.inputReceived(value)
+	}
+	return value, ExecRCNone
 }
 
-// Save serialises the machine state to be restored later
+// output delivers a value output by an executing operation
+func (m *Machine) output(callback OutputCallback, value int) {
+	if callback != nil && !m.history.replaying(m.instructionCount) {
+		callback(value)
+	}
+}
+
+// Save serialises the machine state to be restored later, as a binary snapshot
 func (m *Machine) Save() []byte {
-	buffer := bytes.NewBufferString("")
-	enc := gob.NewEncoder(buffer)
-	ram := map[address]int{}
-	for addr, value := range m.ram {
-		ram[addr] = value.Value()
+	raw, err := m.TrySave()
+	if err != nil {
+		m.fail(err)
 	}
-	state := savedState{
-		RAM:       ram,
-		Registers: m.registers,
-		ModelData: m.model.save(),
+	return raw
+}
+
+// TrySave serialises the machine state to be restored later, returning any encoding error
+func (m *Machine) TrySave() ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := m.Snapshot().Encode(buffer, SnapshotBinary); err != nil {
+		return nil, err
 	}
-	gob.Register(baseInteger{})
-	enc.Encode(state)
-	return buffer.Bytes()
+	return buffer.Bytes(), nil
 }
 
-// Restore recovers machine state from serialised data
+// Restore recovers machine state from a serialised snapshot
 func (m *Machine) Restore(raw []byte) {
-	var state savedState
-
-	dec := gob.NewDecoder(bytes.NewReader(raw))
-	dec.Decode(&state)
-	for reg, value := range state.Registers {
-		m.setRegister(reg, value)
-	}
-	for addr, value := range state.RAM {
-		m.ram[addr] = &baseInteger{
-			machine: m,
-			address: addr,
-			Val:     value,
-		}
+	if err := m.TryRestore(raw); err != nil {
+		m.fail(err)
 	}
-	m.model.restore(state.ModelData)
+}
+
+// TryRestore recovers machine state from a serialised snapshot in either format, returning an
+// error if it is invalid
+//
+// The machine is left unchanged if the data cannot be decoded.
+func (m *Machine) TryRestore(raw []byte) error {
+	s, err := DecodeSnapshot(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	return m.RestoreSnapshot(s)
 }
 
 // Register reads the value from a machine register
@@ -209,12 +377,6 @@ func (m *Machine) setRegister(reg registerID, value int) {
 	m.registers[reg] = value
 }
 
-type savedState struct {
-	RAM       map[address]int `json:"ram"`
-	Registers registerList    `json:"registers"`
-	ModelData interface{}     `json:"modelData"`
-}
-
 type registerList map[registerID]int
 type registerIDList []registerID
 
@@ -231,34 +393,6 @@ const (
 	registerCommonEnd // Used for derived models to continue numbering
 )
 
-type ram map[address]integer
-
-func (r ram) String() string {
-	retString := ""
-	ramAddresses := addressList{}
-	for ramAddress := range r {
-		ramAddresses = append(ramAddresses, ramAddress)
-	}
-	sort.Sort(ramAddresses)
-	lastAddress := address(-1)
-	for _, ramAddress := range ramAddresses {
-		val := r[ramAddress].Value()
-		if ramAddress == lastAddress+1 {
-			if retString != "" {
-				retString += ","
-			}
-			retString += fmt.Sprintf("%d", val)
-			lastAddress = ramAddress
-		} else {
-			if val != 0 {
-				retString += fmt.Sprintf(",...,#%d=%d", ramAddress, val)
-				lastAddress = ramAddress
-			}
-		}
-	}
-	return retString
-}
-
 type operationMap map[address]operation
 
 func (om operationMap) String() string {
@@ -284,12 +418,14 @@ func (om operationMap) String() string {
 
 }
 
-type model interface {
+// boundModel is a Model attached to a machine
+type boundModel interface {
 	name() string
 	parse(program string) error
-	decodeAddress(addr address) operation
-	save() interface{}
-	restore(interface{})
+	decodeAddress(addr address) (operation, error)
+	saveState() map[string]int
+	restoreState(map[string]int)
+	clone(m *Machine) boundModel
 }
 
 // MachineOption defines configuration options that can be applied to an intcode machine
@@ -338,9 +474,11 @@ func (i baseInteger) String() string {
 }
 
 type operation interface {
-	Exec() ExecReturnCode
+	exec() (ExecReturnCode, error)
+	Value() int
 	Name() string
 	NumParams() int
+	paramAddresses() []address
 }
 
 // ExecReturnCode represents the return code from executing an operation
@@ -358,4 +496,8 @@ const (
 
 	// ExecRCInterrupt indicates that operation triggered an interrupt
 	ExecRCInterrupt
+
+	// ExecRCNeedInput indicates that the operation is waiting for input, and will be retried when
+	// the machine is next stepped
+	ExecRCNeedInput
 )
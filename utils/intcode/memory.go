@@ -0,0 +1,298 @@
+package intcode
+
+import (
+	"fmt"
+	"sort"
+)
+
+// memory stores the contents of a machine's RAM
+type memory interface {
+	// read returns the value at addr, and whether it has ever been set
+	read(addr address) (int, bool)
+	// write stores a value, reporting whether addr may have held a decoded instruction
+	write(addr address, value int) bool
+	// clear removes a value, as if it had never been set
+	clear(addr address)
+	// wipe clears all values
+	wipe()
+	// addresses lists the addresses which have been set, in order
+	addresses() addressList
+
+	// decoded returns the cached decoding of the instruction at addr, if any
+	decoded(addr address) operation
+	// cache records the decoding of the instruction at addr until it is next written
+	cache(addr address, op operation)
+
+	// clone creates an independent copy of the memory
+	clone() memory
+
+	String() string
+}
+
+// DenseMemory backs the machine with contiguous pages of values rather than a map, caching
+// decoded instructions until they are overwritten
+//
+// Addresses far beyond the last page are held separately, so sparse accesses remain cheap. Pages
+// are shared copy-on-write between a machine and its clones.
+func DenseMemory() MachineOption {
+	return func(m *Machine) {
+		m.ram = &denseMemory{}
+	}
+}
+
+const (
+	densePageBits = 10
+	densePageSize = 1 << densePageBits
+	densePageMask = densePageSize - 1
+
+	// denseGrowthPages is how many pages beyond twice its current size dense memory will grow to
+	// hold a write
+	denseGrowthPages = 1
+)
+
+// densePage holds a contiguous block of memory
+type densePage struct {
+	values  [densePageSize]int
+	present [densePageSize]bool
+	// frozen pages are shared between clones, and must be copied before being written
+	frozen bool
+}
+
+type denseOps [densePageSize]operation
+
+type denseMemory struct {
+	pages []*densePage
+	ops   []*denseOps
+	far   map[address]int
+}
+
+func (d *denseMemory) read(addr address) (int, bool) {
+	if addr >= 0 {
+		if p := int(addr >> densePageBits); p < len(d.pages) {
+			if page := d.pages[p]; page != nil {
+				return page.values[addr&densePageMask], page.present[addr&densePageMask]
+			}
+			return 0, false
+		}
+	}
+	value, found := d.far[addr]
+	return value, found
+}
+
+func (d *denseMemory) write(addr address, value int) bool {
+	p := int(addr >> densePageBits)
+	if addr >= 0 && p >= len(d.pages) && p < 2*len(d.pages)+denseGrowthPages {
+		d.grow(p + 1)
+	}
+	if addr < 0 || p >= len(d.pages) {
+		if d.far == nil {
+			d.far = map[address]int{}
+		}
+		d.far[addr] = value
+		return true
+	}
+	page := d.writablePage(p)
+	page.values[addr&densePageMask] = value
+	page.present[addr&densePageMask] = true
+	if ops := d.ops[p]; ops != nil && ops[addr&densePageMask] != nil {
+		ops[addr&densePageMask] = nil
+		return true
+	}
+	return false
+}
+
+// writablePage returns a page which may be written by this memory alone, creating or copying it
+// if necessary
+func (d *denseMemory) writablePage(p int) *densePage {
+	page := d.pages[p]
+	switch {
+	case page == nil:
+		page = &densePage{}
+		d.pages[p] = page
+	case page.frozen:
+		copied := *page
+		copied.frozen = false
+		page = &copied
+		d.pages[p] = page
+	}
+	return page
+}
+
+// grow extends memory to hold at least numPages pages, moving in any values held separately
+func (d *denseMemory) grow(numPages int) {
+	d.pages = append(d.pages, make([]*densePage, numPages-len(d.pages))...)
+	d.ops = append(d.ops, make([]*denseOps, numPages-len(d.ops))...)
+	for addr, value := range d.far {
+		if p := int(addr >> densePageBits); addr >= 0 && p < numPages {
+			page := d.writablePage(p)
+			page.values[addr&densePageMask] = value
+			page.present[addr&densePageMask] = true
+			delete(d.far, addr)
+		}
+	}
+}
+
+func (d *denseMemory) clear(addr address) {
+	if p := int(addr >> densePageBits); addr >= 0 && p < len(d.pages) {
+		if d.pages[p] != nil {
+			page := d.writablePage(p)
+			page.values[addr&densePageMask] = 0
+			page.present[addr&densePageMask] = false
+		}
+		if d.ops[p] != nil {
+			d.ops[p][addr&densePageMask] = nil
+		}
+		return
+	}
+	delete(d.far, addr)
+}
+
+func (d *denseMemory) wipe() {
+	d.pages = nil
+	d.ops = nil
+	d.far = nil
+}
+
+func (d *denseMemory) addresses() addressList {
+	addrs := addressList{}
+	for p, page := range d.pages {
+		if page == nil {
+			continue
+		}
+		for offset, present := range page.present {
+			if present {
+				addrs = append(addrs, address(p<<densePageBits+offset))
+			}
+		}
+	}
+	if len(d.far) > 0 {
+		for addr := range d.far {
+			addrs = append(addrs, addr)
+		}
+		sort.Sort(addrs)
+	}
+	return addrs
+}
+
+func (d *denseMemory) decoded(addr address) operation {
+	if p := int(addr >> densePageBits); addr >= 0 && p < len(d.ops) && d.ops[p] != nil {
+		return d.ops[p][addr&densePageMask]
+	}
+	return nil
+}
+
+func (d *denseMemory) cache(addr address, op operation) {
+	if p := int(addr >> densePageBits); addr >= 0 && p < len(d.ops) {
+		if d.ops[p] == nil {
+			d.ops[p] = &denseOps{}
+		}
+		d.ops[p][addr&densePageMask] = op
+	}
+}
+
+// clone shares all pages with the copy, freezing them so that each copies a page before writing
+// to it
+//
+// Decoded instructions are bound to a machine, so are not shared.
+func (d *denseMemory) clone() memory {
+	for _, page := range d.pages {
+		if page != nil {
+			page.frozen = true
+		}
+	}
+	c := &denseMemory{
+		pages: append([]*densePage{}, d.pages...),
+		ops:   make([]*denseOps, len(d.ops)),
+	}
+	if len(d.far) > 0 {
+		c.far = make(map[address]int, len(d.far))
+		for addr, value := range d.far {
+			c.far[addr] = value
+		}
+	}
+	return c
+}
+
+func (d *denseMemory) String() string {
+	return formatMemory(d)
+}
+
+type ram map[address]integer
+
+func (r ram) read(addr address) (int, bool) {
+	if value, found := r[addr]; found {
+		return value.Value(), true
+	}
+	return 0, false
+}
+
+func (r ram) write(addr address, value int) bool {
+	if r[addr] == nil {
+		r[addr] = &baseInteger{
+			address: addr,
+			Val:     value,
+		}
+	} else {
+		r[addr].Set(value)
+	}
+	return true
+}
+
+func (r ram) clear(addr address) {
+	delete(r, addr)
+}
+
+func (r ram) wipe() {
+	for addr := range r {
+		delete(r, addr)
+	}
+}
+
+func (r ram) addresses() addressList {
+	addrs := make(addressList, 0, len(r))
+	for addr := range r {
+		addrs = append(addrs, addr)
+	}
+	sort.Sort(addrs)
+	return addrs
+}
+
+func (r ram) decoded(addr address) operation   { return nil }
+func (r ram) cache(addr address, op operation) {}
+
+func (r ram) clone() memory {
+	c := make(ram, len(r))
+	for addr, value := range r {
+		c[addr] = &baseInteger{
+			address: addr,
+			Val:     value.Value(),
+		}
+	}
+	return c
+}
+
+func (r ram) String() string {
+	return formatMemory(r)
+}
+
+// formatMemory lists the contents of memory, eliding gaps of unset addresses
+func formatMemory(mem memory) string {
+	retString := ""
+	lastAddress := address(-1)
+	for _, ramAddress := range mem.addresses() {
+		val, _ := mem.read(ramAddress)
+		if ramAddress == lastAddress+1 {
+			if retString != "" {
+				retString += ","
+			}
+			retString += fmt.Sprintf("%d", val)
+			lastAddress = ramAddress
+		} else {
+			if val != 0 {
+				retString += fmt.Sprintf(",...,#%d=%d", ramAddress, val)
+				lastAddress = ramAddress
+			}
+		}
+	}
+	return retString
+}
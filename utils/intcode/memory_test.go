@@ -0,0 +1,162 @@
+package intcode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDenseMemory(t *testing.T) {
+	d := &denseMemory{}
+	sparse := ram{}
+	for _, mem := range []memory{d, sparse} {
+		mem.write(3, 30)
+		mem.write(0, 1)
+		mem.write(1000000, 7)
+		mem.write(10, 0)
+	}
+	assert.Len(t, d.pages, 1)
+	assert.Equal(t, map[address]int{1000000: 7}, d.far)
+	assert.Equal(t, sparse.String(), d.String())
+	assert.Equal(t, addressList{0, 3, 10, 1000000}, d.addresses())
+
+	value, found := d.read(3)
+	assert.Equal(t, 30, value)
+	assert.True(t, found)
+	_, found = d.read(2)
+	assert.False(t, found)
+
+	// Growing over values held separately moves them into pages
+	d.write(400000, 4)
+	d.write(800000, 8)
+	d.write(600000, 6)
+	assert.Len(t, d.far, 4)
+	d.grow(900)
+	assert.Equal(t, map[address]int{1000000: 7}, d.far)
+	value, found = d.read(800000)
+	assert.Equal(t, 8, value)
+	assert.True(t, found)
+
+	d.clear(3)
+	d.clear(1000000)
+	assert.Equal(t, addressList{0, 10, 400000, 600000, 800000}, d.addresses())
+
+	d.wipe()
+	assert.Empty(t, d.addresses())
+	assert.Empty(t, d.pages)
+}
+
+func TestDenseMemoryDecodeCache(t *testing.T) {
+	m := NewMachine(M19(nil, nil), DenseMemory())
+	assert.NoError(t, m.LoadProgram("1101,1,1,4,42"))
+	m.Step()
+	assert.Nil(t, m.ram.decoded(4))
+	assert.NotNil(t, m.ram.decoded(0))
+
+	// Rewriting an executed instruction discards its decoding
+	m.WriteRAM(0, 1102)
+	assert.Nil(t, m.ram.decoded(0))
+	m.setRegister(RegisterInstructionPointer, 0)
+	m.Step()
+	assert.Equal(t, 1, m.ReadRAM(4))
+	m.WriteRAM(4, 99)
+	assert.Equal(t, ExecRCHCF, m.Step())
+}
+
+func TestDenseMemoryMatchesSparse(t *testing.T) {
+	type testDef struct {
+		program string
+		input   int
+	}
+	tests := []testDef{
+		{loadTestProgram(t, "day09"), 1},
+		{loadTestProgram(t, "day09"), 2},
+		{loadTestProgram(t, "day19"), 20},
+		{"109,1,204,-1,1001,100,1,100,1008,100,16,101,1006,101,0,99", 0},
+		{"3,9,8,9,10,9,4,9,99,-1,8", 8},
+		{"1101,5,0,1000000,1,1000000,1000000,2000000,4,2000000,99", 0},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			results := []string{}
+			for _, engine := range []MachineOption{func(*Machine) {}, DenseMemory()} {
+				outputs := []int{}
+				m := NewMachine(
+					M19(
+						func() (int, bool) { return test.input, false },
+						func(out int) { outputs = append(outputs, out) },
+					),
+					engine,
+				)
+				assert.NoError(t, m.LoadProgram(test.program))
+				_, err := m.TryRun(false)
+				assert.NoError(t, err)
+				results = append(results, fmt.Sprintf("%v\n%d\n%v\n%v", outputs, m.instructionCount, m.registers, m.ram))
+			}
+			assert.Equal(t, results[0], results[1])
+		})
+	}
+}
+
+func TestDenseMemoryHistory(t *testing.T) {
+	m, _, outputs := newHistoryTestMachine(t, DenseMemory(), History(5, 10, 100))
+	states := []string{historyTestState(m)}
+	for i := 0; i < 40; i++ {
+		m.Step()
+		states = append(states, historyTestState(m))
+	}
+	assert.NoError(t, m.StepBack(2))
+	assert.Equal(t, states[38], historyTestState(m))
+	assert.NoError(t, m.RewindTo(3))
+	assert.Equal(t, states[3], historyTestState(m))
+	m.Run(false)
+	assert.Len(t, *outputs, 20)
+}
+
+func loadTestProgram(t testing.TB, day string) string {
+	raw, err := ioutil.ReadFile("../../" + day + "/input.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func benchmarkEngines(b *testing.B, run func(b *testing.B, engine MachineOption)) {
+	b.Run("Sparse", func(b *testing.B) { run(b, func(*Machine) {}) })
+	b.Run("Dense", func(b *testing.B) { run(b, DenseMemory()) })
+}
+
+func BenchmarkDay09Boost(b *testing.B) {
+	program := loadTestProgram(b, "day09")
+	benchmarkEngines(b, func(b *testing.B, engine MachineOption) {
+		for i := 0; i < b.N; i++ {
+			m := NewMachine(M19(func() (int, bool) { return 2, false }, nil), engine)
+			m.LoadProgram(program)
+			m.Run(false)
+		}
+	})
+}
+
+func BenchmarkDay19Scan(b *testing.B) {
+	program := loadTestProgram(b, "day19")
+	benchmarkEngines(b, func(b *testing.B, engine MachineOption) {
+		for i := 0; i < b.N; i++ {
+			count := 0
+			for y := 0; y < 20; y++ {
+				for x := 0; x < 20; x++ {
+					inputs := []int{x, y}
+					m := NewMachine(M19(func() (int, bool) {
+						next := inputs[0]
+						inputs = inputs[1:]
+						return next, false
+					}, nil), engine)
+					m.LoadProgram(program)
+					m.Run(true)
+					count += m.Register(M19RegisterOutput)
+				}
+			}
+		}
+	})
+}
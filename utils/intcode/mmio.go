@@ -0,0 +1,172 @@
+package intcode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Device is a peripheral mapped into a range of a machine's address space
+//
+// Reads and writes made by executing instructions within the range are passed to the device,
+// with the offset from the start of the range, instead of accessing RAM. Instructions cannot be
+// fetched from devices, and device contents are not included in snapshots or diffs.
+type Device interface {
+	Read(offset int) int
+	Write(offset int, value int)
+}
+
+// AttachDevice maps a device to size addresses starting at start, panicking if it cannot be
+// attached
+func AttachDevice(start, size int, device Device) MachineOption {
+	return func(m *Machine) {
+		if err := m.Attach(start, size, device); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// mappedDevice is a device attached to an address range
+type mappedDevice struct {
+	start, end address
+	device     Device
+}
+
+// Attach maps a device to size addresses starting at start, which must not overlap any other
+// device
+//
+// Re-executing instructions while stepping backwards with History repeats their device reads,
+// and undoing them does not undo their device writes, which RunBackToWrite does not find.
+func (m *Machine) Attach(start, size int, device Device) error {
+	mapped := mappedDevice{address(start), address(start + size), device}
+	switch {
+	case start < 0:
+		return fmt.Errorf("Cannot attach device at %v: %w", address(start), ErrNegativeAddress)
+	case size < 1:
+		return fmt.Errorf("Cannot attach device at %v: size %d", address(start), size)
+	}
+	for _, other := range m.devices {
+		if mapped.start < other.end && other.start < mapped.end {
+			return fmt.Errorf("Cannot attach device at %v: overlaps device at %v", mapped.start, other.start)
+		}
+	}
+	m.devices = append(m.devices, mapped)
+	sort.Slice(m.devices, func(i, j int) bool { return m.devices[i].start < m.devices[j].start })
+	return nil
+}
+
+// Detach unmaps a device from every range it is attached to
+func (m *Machine) Detach(device Device) {
+	devices := m.devices[:0]
+	for _, mapped := range m.devices {
+		if mapped.device != device {
+			devices = append(devices, mapped)
+		}
+	}
+	m.devices = devices
+}
+
+// device finds the device mapped at addr, if any
+func (m *Machine) device(addr address) (mappedDevice, bool) {
+	i := sort.Search(len(m.devices), func(i int) bool { return m.devices[i].end > addr })
+	if i < len(m.devices) && m.devices[i].start <= addr {
+		return m.devices[i], true
+	}
+	return mappedDevice{}, false
+}
+
+// Display is a device holding a frame buffer of width by height cells, addressed row by row
+type Display struct {
+	Width, Height int
+	// Palette maps cell values to the characters used by String, with '?' for other values
+	Palette map[int]rune
+	cells   []int
+}
+
+// NewDisplay creates a display with every cell set to 0, drawn as '.', and 1 drawn as '#'
+func NewDisplay(width, height int) *Display {
+	return &Display{
+		Width:   width,
+		Height:  height,
+		Palette: map[int]rune{0: '.', 1: '#'},
+		cells:   make([]int, width*height),
+	}
+}
+
+// Size returns the number of addresses used by the display
+func (d *Display) Size() int {
+	return len(d.cells)
+}
+
+// Read returns the value of a cell
+func (d *Display) Read(offset int) int {
+	return d.cells[offset]
+}
+
+// Write sets the value of a cell
+func (d *Display) Write(offset int, value int) {
+	d.cells[offset] = value
+}
+
+// Pixel returns the value of the cell at x, y
+func (d *Display) Pixel(x, y int) int {
+	return d.cells[y*d.Width+x]
+}
+
+func (d *Display) String() string {
+	var sb strings.Builder
+	for y := 0; y < d.Height; y++ {
+		for x := 0; x < d.Width; x++ {
+			char, found := d.Palette[d.Pixel(x, y)]
+			if !found {
+				char = '?'
+			}
+			sb.WriteRune(char)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// Keyboard is a two address device buffering key presses
+//
+// Reading offset 0 returns the next key, or 0 if none are waiting, and reading offset 1 returns
+// the number of keys waiting. Writing to offset 1 discards any waiting keys.
+type Keyboard struct {
+	keys []int
+}
+
+// KeyboardSize is the number of addresses used by a Keyboard
+const KeyboardSize = 2
+
+// Press adds keys to the buffer
+func (k *Keyboard) Press(keys ...int) {
+	k.keys = append(k.keys, keys...)
+}
+
+// Type adds the characters of a string to the buffer
+func (k *Keyboard) Type(text string) {
+	for _, char := range []byte(text) {
+		k.keys = append(k.keys, int(char))
+	}
+}
+
+// Read returns the next key or the number of keys waiting
+func (k *Keyboard) Read(offset int) int {
+	if offset == 1 {
+		return len(k.keys)
+	}
+	if len(k.keys) == 0 {
+		return 0
+	}
+	key := k.keys[0]
+	k.keys = k.keys[1:]
+	return key
+}
+
+// Write clears the buffer when writing to offset 1
+func (k *Keyboard) Write(offset int, value int) {
+	if offset == 1 {
+		k.keys = nil
+	}
+}
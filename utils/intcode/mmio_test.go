@@ -0,0 +1,82 @@
+package intcode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const displayTestSource = `
+	       ARB  3000
+	loop:  CEQ  [1001], 0, [empty]
+	       JNZ  [empty], done
+	       ADD  [1000], -64, [rb]
+	       ARB  1
+	       JNZ  1, loop
+	done:  HCF
+	empty: DATA 0
+`
+
+func TestDevices(t *testing.T) {
+	program, err := Assemble(displayTestSource)
+	assert.NoError(t, err)
+
+	keyboard := &Keyboard{}
+	keyboard.Type("AB")
+	display := NewDisplay(3, 2)
+	display.Palette[2] = '@'
+	m := NewMachine(M19(nil, nil), AttachDevice(1000, KeyboardSize, keyboard))
+	assert.NoError(t, m.Attach(3000, display.Size(), display))
+	assert.NoError(t, m.LoadProgram(program))
+
+	rc, err := m.TryRun(false)
+	assert.NoError(t, err)
+	assert.Equal(t, ExecRCHCF, rc)
+	assert.Equal(t, 2, display.Pixel(1, 0))
+	assert.Equal(t, "#@.\n...\n", display.String())
+	_, found := m.Memory()[3001]
+	assert.False(t, found)
+	assert.Equal(t, 0, keyboard.Read(1))
+}
+
+func TestAttachErrors(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	display := NewDisplay(2, 2)
+	assert.NoError(t, m.Attach(10, 4, display))
+	assert.EqualError(t, m.Attach(13, 2, &Keyboard{}), "Cannot attach device at #0013: overlaps device at #0010")
+	assert.EqualError(t, m.Attach(8, 3, &Keyboard{}), "Cannot attach device at #0008: overlaps device at #0010")
+	assert.Error(t, m.Attach(-1, 1, &Keyboard{}))
+	assert.Error(t, m.Attach(20, 0, &Keyboard{}))
+	assert.NoError(t, m.Attach(14, 2, &Keyboard{}))
+	assert.NoError(t, m.Attach(6, 4, &Keyboard{}))
+
+	m.Detach(display)
+	assert.NoError(t, m.Attach(10, 4, &Keyboard{}))
+	assert.Panics(t, func() { NewMachine(AttachDevice(0, 0, display)) })
+}
+
+func TestDevicesWithHooks(t *testing.T) {
+	program, err := Assemble(`
+		ADD  5, 0, [1000]
+		ADD  [1000], 0, [key]
+		HCF
+		key: DATA 0
+	`)
+	assert.NoError(t, err)
+
+	keyboard := &Keyboard{}
+	keyboard.Type("AB")
+	trace := NewRingTraceSink(10)
+	m := NewMachine(M19(nil, nil), AttachDevice(1000, KeyboardSize, keyboard), Trace(trace), History(10, 0, 0))
+	assert.NoError(t, m.LoadProgram(program))
+	m.Run(false)
+	assert.Equal(t, int('A'), m.ReadRAM(9))
+	assert.Equal(t, 1, keyboard.Read(1))
+
+	assert.EqualError(t, m.RunBackToWrite(1000), "No write to #1000 found in history")
+	assert.NoError(t, m.StepBack(3))
+	_, found := m.Memory()[1000]
+	assert.False(t, found)
+	assert.Equal(t, 0, m.ReadRAM(9))
+	assert.Equal(t, 1, keyboard.Read(1))
+}
@@ -0,0 +1,527 @@
+package intcode
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Model defines the instructions understood by a machine
+//
+// Instructions follow the AoC 2019 encoding, with the opcode in the lowest two digits of the
+// instruction value and the mode of each parameter in the following digits.
+type Model interface {
+	// Name identifies the model, e.g. in snapshots
+	Name() string
+	// Decode looks up the opcode and parameter modes of an instruction value, returning an
+	// *ExecError if it is not valid in this model
+	Decode(value int) (Opcode, []ParamMode, error)
+}
+
+// ParamMode is the addressing mode of an instruction parameter
+type ParamMode int
+
+const (
+	// ModePositional parameters hold the address of their value
+	ModePositional ParamMode = iota
+	// ModeImmediate parameters hold their value directly
+	ModeImmediate
+	// ModeRelative parameters hold an offset from the M19RelativeBase register
+	ModeRelative
+)
+
+// OpcodeExec performs an instruction
+//
+// The instruction pointer has already been advanced past the instruction when it is called.
+type OpcodeExec func(in *Instruction) (ExecReturnCode, error)
+
+// Opcode defines an instruction which can be registered with an InstructionSet
+type Opcode struct {
+	// Code is the value of the lowest two digits of the instruction, from 1 to 99
+	Code int
+	// Name is the mnemonic used by the assembler and disassembler
+	Name      string
+	NumParams int
+	// WriteParam is the index of the parameter written to, or -1 if none
+	WriteParam int
+	Exec       OpcodeExec
+}
+
+// InstructionSet is a Model built from registered opcodes
+//
+// A set is sealed once it is bound to a machine with WithModel or registered with RegisterModel,
+// as the built-in models are, after which its opcodes cannot change.
+type InstructionSet struct {
+	name  string
+	modes map[ParamMode]bool
+
+	mu      sync.RWMutex
+	opcodes map[int]Opcode
+	sealed  bool
+}
+
+// NewInstructionSet creates an empty model allowing the given parameter modes
+func NewInstructionSet(name string, modes ...ParamMode) *InstructionSet {
+	s := &InstructionSet{
+		name:    name,
+		modes:   map[ParamMode]bool{},
+		opcodes: map[int]Opcode{},
+	}
+	for _, mode := range modes {
+		s.modes[mode] = true
+	}
+	return s
+}
+
+// Register adds opcodes to the instruction set
+//
+// No opcodes are added if any clash with an existing code or name, or are not valid, or if the set
+// is sealed. Use Extend to add opcodes to a sealed set.
+func (s *InstructionSet) Register(opcodes ...Opcode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sealed {
+		return fmt.Errorf("Cannot register opcodes with %s: instruction set is in use (try Extend)", s.name)
+	}
+	added := map[int]bool{}
+	names := map[string]bool{}
+	for _, op := range s.opcodes {
+		names[op.Name] = true
+	}
+	for _, op := range opcodes {
+		switch {
+		case op.Code < 1 || op.Code > 99:
+			return fmt.Errorf("Cannot register %s: opcode %d out of range", op.Name, op.Code)
+		case op.Name == "":
+			return fmt.Errorf("Cannot register opcode %d: no name", op.Code)
+		case op.Exec == nil:
+			return fmt.Errorf("Cannot register %s: no Exec function", op.Name)
+		case op.NumParams < 0 || op.WriteParam < -1 || op.WriteParam >= op.NumParams:
+			return fmt.Errorf("Cannot register %s: invalid parameters", op.Name)
+		case added[op.Code] || s.opcodes[op.Code].Exec != nil:
+			return fmt.Errorf("Cannot register %s: opcode %d already registered", op.Name, op.Code)
+		case names[op.Name]:
+			return fmt.Errorf("Cannot register %s: name already registered", op.Name)
+		}
+		added[op.Code] = true
+		names[op.Name] = true
+	}
+	for _, op := range opcodes {
+		s.opcodes[op.Code] = op
+	}
+	return nil
+}
+
+// Extend creates a new instruction set with the opcodes and modes of this one, plus the given
+// opcodes
+func (s *InstructionSet) Extend(name string, opcodes ...Opcode) (*InstructionSet, error) {
+	extended := NewInstructionSet(name)
+	for mode := range s.modes {
+		extended.modes[mode] = true
+	}
+	s.mu.RLock()
+	for code, op := range s.opcodes {
+		extended.opcodes[code] = op
+	}
+	s.mu.RUnlock()
+	if err := extended.Register(opcodes...); err != nil {
+		return nil, err
+	}
+	return extended, nil
+}
+
+// seal prevents any more opcodes being registered
+func (s *InstructionSet) seal() {
+	s.mu.Lock()
+	s.sealed = true
+	s.mu.Unlock()
+}
+
+// Name identifies the instruction set
+func (s *InstructionSet) Name() string {
+	return s.name
+}
+
+// Opcodes lists the registered opcodes in code order
+func (s *InstructionSet) Opcodes() []Opcode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	opcodes := make([]Opcode, 0, len(s.opcodes))
+	for _, op := range s.opcodes {
+		opcodes = append(opcodes, op)
+	}
+	sort.Slice(opcodes, func(i, j int) bool { return opcodes[i].Code < opcodes[j].Code })
+	return opcodes
+}
+
+// Lookup finds a registered opcode by code
+func (s *InstructionSet) Lookup(code int) (Opcode, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	op, found := s.opcodes[code]
+	return op, found
+}
+
+// LookupName finds a registered opcode by mnemonic
+func (s *InstructionSet) LookupName(name string) (Opcode, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, op := range s.opcodes {
+		if op.Name == name {
+			return op, true
+		}
+	}
+	return Opcode{}, false
+}
+
+// Decode looks up the opcode and parameter modes of an instruction value
+func (s *InstructionSet) Decode(value int) (Opcode, []ParamMode, error) {
+	op, modes, found := s.split(value)
+	if !found {
+		return op, nil, &ExecError{Err: ErrInvalidOpcode, Opcode: value, Mode: -1}
+	}
+	for i, mode := range modes {
+		var err error
+		switch {
+		case !s.modes[mode]:
+			err = ErrInvalidMode
+		case i == op.WriteParam && mode == ModeImmediate:
+			err = ErrImmediateWrite
+		}
+		if err != nil {
+			return op, nil, &ExecError{Err: err, Opcode: value, Param: i + 1, Mode: int(mode)}
+		}
+	}
+	return op, modes, nil
+}
+
+// split separates an instruction value into its opcode and parameter modes, without checking the
+// modes are valid
+func (s *InstructionSet) split(value int) (Opcode, []ParamMode, bool) {
+	op, found := s.Lookup(value % 100)
+	if !found {
+		return op, nil, false
+	}
+	modeDigits := value / 100
+	modes := make([]ParamMode, op.NumParams)
+	for i := range modes {
+		modes[i] = ParamMode(modeDigits % 10)
+		modeDigits /= 10
+	}
+	return op, modes, true
+}
+
+var (
+	modelsLock sync.RWMutex
+	models     = map[string]Model{}
+)
+
+// RegisterModel makes a model available by name, e.g. to restore snapshots taken from it
+//
+// An InstructionSet is sealed once registered.
+func RegisterModel(model Model) error {
+	modelsLock.Lock()
+	defer modelsLock.Unlock()
+	if _, found := models[model.Name()]; found {
+		return fmt.Errorf("Model %s is already registered", model.Name())
+	}
+	if s, ok := model.(*InstructionSet); ok {
+		s.seal()
+	}
+	models[model.Name()] = model
+	return nil
+}
+
+// LookupModel finds a registered model by name
+func LookupModel(name string) (Model, bool) {
+	modelsLock.RLock()
+	defer modelsLock.RUnlock()
+	model, found := models[name]
+	return model, found
+}
+
+// InputCallback is the function to be used by the processor to retrieve new input
+//
+// Returning true halts the machine. Values queued with QueueInput are read before the callback is
+// called.
+type InputCallback func() (int, bool)
+
+// OutputCallback is the function called by the processor when a value is output
+type OutputCallback func(int)
+
+// WithModel sets the instructions understood by the machine, reading input from and writing
+// output to the given callbacks
+//
+// With a nil inputCallback, input is read only from QueueInput and an input instruction with no
+// input queued returns ExecRCNeedInput without advancing the instruction pointer. An InstructionSet
+// is sealed once bound.
+func WithModel(model Model, inputCallback InputCallback, outputCallback OutputCallback) MachineOption {
+	return func(m *Machine) {
+		if s, ok := model.(*InstructionSet); ok {
+			s.seal()
+		}
+		m.model = &modelBinding{
+			machine:        m,
+			model:          model,
+			inputCallback:  inputCallback,
+			outputCallback: outputCallback,
+		}
+	}
+}
+
+// DecodeOps decodes instructions from address 0 whenever a program is loaded or restored, rather
+// than as they are executed
+func DecodeOps() MachineOption {
+	return func(m *Machine) {
+		m.model.(*modelBinding).decodeOps = true
+	}
+}
+
+// opcodeDecoder looks up the definition and parameter modes of an instruction value, reporting
+// whether it is a valid instruction
+type opcodeDecoder func(value int) (Opcode, []ParamMode, bool)
+
+// decoder returns the instruction decoder of the machine's model, or that of the AoC 2019 model if
+// it has none
+func (m *Machine) decoder() opcodeDecoder {
+	b, bound := m.model.(*modelBinding)
+	if !bound {
+		return decodeM19
+	}
+	return func(value int) (Opcode, []ParamMode, bool) {
+		def, modes, err := b.model.Decode(value)
+		return def, modes, err == nil
+	}
+}
+
+// modelBinding attaches a Model to a machine
+type modelBinding struct {
+	machine *Machine
+	model   Model
+
+	inputCallback  InputCallback
+	outputCallback OutputCallback
+
+	decodeOps bool
+}
+
+func (b *modelBinding) name() string {
+	return b.model.Name()
+}
+
+func (b *modelBinding) parse(program string) error {
+	values, err := parseProgram(program)
+	if err != nil {
+		return err
+	}
+	for pos, value := range values {
+		b.machine.WriteRAM(address(pos), value)
+	}
+	if b.decodeOps {
+		b.guessOps()
+	}
+	return nil
+}
+
+func (b *modelBinding) saveState() map[string]int {
+	if b.decodeOps {
+		return map[string]int{"decodeOps": 1}
+	}
+	return nil
+}
+
+func (b *modelBinding) restoreState(data map[string]int) {
+	b.decodeOps = data["decodeOps"] != 0
+	if b.decodeOps {
+		b.guessOps()
+	}
+}
+
+func (b *modelBinding) clone(machine *Machine) boundModel {
+	copied := *b
+	copied.machine = machine
+	return &copied
+}
+
+func (b *modelBinding) decodeAddress(addr address) (operation, error) {
+	value := b.machine.readAddress(addr)
+	op, modes, err := b.model.Decode(value)
+	if err != nil {
+		if execErr, ok := err.(*ExecError); ok {
+			execErr.Address = int(addr)
+			return nil, execErr
+		}
+		return nil, &ExecError{Err: err, Address: int(addr), Opcode: value, Mode: -1}
+	}
+	return &Instruction{
+		binding: b,
+		address: addr,
+		value:   value,
+		opcode:  op,
+		modes:   modes,
+		params:  make([]address, op.NumParams),
+	}, nil
+}
+
+func (b *modelBinding) guessOps() {
+	// Scrolling up to len(ram) is fine in the initial case, will need changing if re-running later
+	size := len(b.machine.ram.addresses())
+	for addr := address(0); int(addr) < size; addr++ {
+		op, err := b.decodeAddress(addr)
+		if err != nil {
+			return
+		}
+		b.machine.operations[addr] = op
+		b.machine.ram.cache(addr, op)
+		addr += address(op.NumParams())
+	}
+}
+
+// Instruction is a decoded instruction, passed to an OpcodeExec to access its parameters and
+// the machine executing it
+type Instruction struct {
+	binding *modelBinding
+	address address
+	value   int
+	opcode  Opcode
+	modes   []ParamMode
+	params  []address
+}
+
+// Address returns the location of the instruction
+func (in *Instruction) Address() int { return int(in.address) }
+
+// Value returns the raw value of the instruction
+func (in *Instruction) Value() int { return in.value }
+
+// Name returns the mnemonic of the instruction
+func (in *Instruction) Name() string { return in.opcode.Name }
+
+// NumParams returns the number of parameters taken by the instruction
+func (in *Instruction) NumParams() int { return in.opcode.NumParams }
+
+// Machine returns the machine executing the instruction
+func (in *Instruction) Machine() *Machine { return in.binding.machine }
+
+// Read loads the value of a parameter, counting from 0
+func (in *Instruction) Read(param int) int {
+	return in.binding.machine.loadAddress(in.params[param])
+}
+
+// Write stores a value at the address of a parameter, counting from 0
+func (in *Instruction) Write(param int, value int) {
+	in.binding.machine.writeAddress(in.params[param], value)
+}
+
+// Jump sets the instruction pointer
+func (in *Instruction) Jump(target int) {
+	in.binding.machine.setRegister(RegisterInstructionPointer, target)
+}
+
+// SetRegister sets the value of a machine register
+func (in *Instruction) SetRegister(reg registerID, value int) {
+	in.binding.machine.setRegister(reg, value)
+}
+
+// Input reads the next input value
+//
+// If no input is available, the instruction pointer is returned to the instruction and
+// ExecRCNeedInput is returned, or ExecRCHCF if the input callback halted the machine. Either
+// should be returned by the OpcodeExec.
+func (in *Instruction) Input() (int, ExecReturnCode) {
+	value, rc := in.binding.machine.input(in.binding.inputCallback)
+	if rc == ExecRCNeedInput {
+		in.Jump(int(in.address))
+	}
+	return value, rc
+}
+
+// Output stores a value in the M19RegisterOutput register and passes it to the output callback
+func (in *Instruction) Output(value int) {
+	in.binding.machine.setRegister(M19RegisterOutput, value)
+	in.binding.machine.output(in.binding.outputCallback, value)
+}
+
+func (in *Instruction) exec() (ExecReturnCode, error) {
+	if _, err := in.resolveParams(); err != nil {
+		return ExecRCInvalidInstruction, err
+	}
+	if err := in.checkSelfModify(); err != nil {
+		return ExecRCInvalidInstruction, err
+	}
+	in.binding.machine.registers[RegisterInstructionPointer] += 1 + in.opcode.NumParams
+	return in.opcode.Exec(in)
+}
+
+func (in *Instruction) paramAddresses() []address {
+	addrs, _ := in.resolveParams()
+	return addrs
+}
+
+// resolveParams resolves the address accessed by each parameter
+//
+// The returned slice is reused by subsequent calls.
+func (in *Instruction) resolveParams() ([]address, error) {
+	machine := in.binding.machine
+	for i, mode := range in.modes {
+		paramAddress := in.address + address(i+1)
+		indirectAddress := address(machine.readAddress(paramAddress))
+
+		switch mode {
+		case ModeImmediate:
+			in.params[i] = paramAddress
+		case ModePositional:
+			in.params[i] = indirectAddress
+		case ModeRelative:
+			in.params[i] = indirectAddress + address(machine.Register(M19RelativeBase))
+		default:
+			return in.params, in.execError(ErrInvalidMode, i+1)
+		}
+		if in.params[i] < 0 {
+			return in.params, in.execError(ErrNegativeAddress, i+1)
+		}
+		if _, found := machine.bigValues[paramAddress]; found && mode != ModeImmediate {
+			return in.params, in.execError(ErrOverflow, i+1)
+		}
+	}
+	return in.params, nil
+}
+
+// execError describes a failure of this instruction, caused by the given parameter (counting from 1)
+func (in *Instruction) execError(err error, param int) *ExecError {
+	execErr := &ExecError{
+		Err:     err,
+		Address: int(in.address),
+		Opcode:  in.value,
+		Param:   param,
+		Mode:    -1,
+	}
+	if param > 0 {
+		execErr.Mode = int(in.modes[param-1])
+	}
+	return execErr
+}
+
+func (in *Instruction) String() string {
+	machine := in.binding.machine
+	retString := in.opcode.Name
+	for i, mode := range in.modes {
+		paramAddress := in.address + address(i+1)
+		paramInteger := machine.readAddress(paramAddress)
+
+		switch mode {
+		case ModeImmediate:
+			retString = fmt.Sprintf("%s\t'%v'", retString, paramInteger)
+		case ModePositional:
+			dereferenced := machine.readAddress(address(paramInteger))
+			retString = fmt.Sprintf("%s\t#%v (%d)", retString, paramInteger, dereferenced)
+		case ModeRelative:
+			offset := machine.Register(M19RelativeBase)
+			dereferenced := machine.readAddress(address(paramInteger + offset))
+			retString = fmt.Sprintf("%s\t#%v+%v (%d)", retString, paramInteger, offset, dereferenced)
+		default:
+			retString = fmt.Sprintf("%s\t??'%v'", retString, paramInteger)
+		}
+	}
+	return retString
+}
@@ -1,11 +1,6 @@
 package intcode
 
-import (
-	"encoding/gob"
-	"fmt"
-	"strconv"
-	"strings"
-)
+import "math/big"
 
 const (
 	// M19RegisterOutput is the register used to store the last value output
@@ -15,166 +10,26 @@ const (
 	M19RelativeBase
 )
 
-// InputCallback is the function to be used by the processor to retrieve new input
-type InputCallback func() (int, bool)
-
-// OutputCallback is the function called by the processor when a value is output
-type OutputCallback func(int)
-
 // M19 sets the behaviour of the intcode machine to AoC 2019 rules
+//
+// With a nil inputCallback, input is read only from QueueInput and an INP with no input queued
+// returns ExecRCNeedInput without advancing the instruction pointer.
 func M19(inputCallback InputCallback, outputCallback OutputCallback) MachineOption {
-	return func(m *Machine) {
-		m.model = &m19{
-			machine:        m,
-			inputCallback:  inputCallback,
-			outputCallback: outputCallback,
-		}
-	}
-}
-
-func DecodeOps() MachineOption {
-	return func(m *Machine) {
-		m.model.(*m19).decodeOps = true
-	}
-}
-
-type m19 struct {
-	machine *Machine
-
-	relativeBase   int
-	inputCallback  InputCallback
-	outputCallback OutputCallback
-
-	decodeOps bool
+	return WithModel(M19Model, inputCallback, outputCallback)
 }
 
-func (m *m19) name() string {
-	return "M19"
+// Day2 sets the behaviour of the intcode machine to the rules of AoC 2019 day 2, which has no I/O
+func Day2() MachineOption {
+	return WithModel(Day2Model, nil, nil)
 }
 
-func (m *m19) parse(program string) error {
-	programIntStrings := strings.Split(strings.TrimSpace(program), ",")
-
-	for pos, valString := range programIntStrings {
-		value, err := strconv.Atoi(valString)
-		if err != nil {
-			panic(err)
-		}
-		decode := &baseInteger{
-			machine: m.machine,
-			address: address(pos),
-			Val:     value,
-		}
-		m.machine.ram[address(pos)] = decode
-	}
-	if m.decodeOps {
-		m.guessOps()
-	}
-	return nil
-}
-
-type saveData struct {
-	RelativeBase int
-	DecodeOps    bool
-}
-
-func (m *m19) save() interface{} {
-	gob.Register(saveData{})
-	return saveData{
-		RelativeBase: m.relativeBase,
-		DecodeOps:    m.decodeOps,
-	}
-}
-
-func (m *m19) restore(data interface{}) {
-	dataAssert := data.(saveData)
-	m.relativeBase = dataAssert.RelativeBase //int(math.Round(dataAssert["relativeBase"].(float64)))
-	m.decodeOps = dataAssert.DecodeOps
-	if m.decodeOps {
-		m.guessOps()
-	}
-}
-
-func (m *m19) decodeAddress(addr address) operation {
-	op := &m19operation{
-		baseInteger: &baseInteger{
-			machine: m.machine,
-			address: addr,
-			Val:     m.machine.readAddress(addr).Value(),
-		},
-	}
-	opCode := m19operationCode(op.Value() % 100)
-	opMode := op.Value() / 100
-	switch opCode {
-	case m19OpAdd:
-		op.repr = "ADD"
-		op.numParams = 3
-	case m19OpMultiply:
-		op.repr = "MUL"
-		op.numParams = 3
-	case m19OpInput:
-		op.repr = "INP"
-		op.numParams = 1
-	case m19OpOutput:
-		op.repr = "OUT"
-		op.numParams = 1
-	case m19OpJumpTrue:
-		op.repr = "JNZ"
-		op.numParams = 2
-	case m19OpJumpFalse:
-		op.repr = "JEZ"
-		op.numParams = 2
-	case m19OpLess:
-		op.repr = "CLT"
-		op.numParams = 3
-	case m19OpEqual:
-		op.repr = "CEQ"
-		op.numParams = 3
-	case m19OpAdjustRelativeBase:
-		op.repr = "ARB"
-		op.numParams = 1
-	case m19OpHCF:
-		op.repr = "HCF"
-		op.numParams = 0
-	default:
-		op.repr = fmt.Sprintf("UNK-%d", opCode)
-		return nil
-	}
-	op.mode = make([]m19opMode, op.NumParams())
-	for i := 0; i < op.numParams; i++ {
-		op.mode[i] = m19opMode(opMode % 10)
-		opMode /= 10
-	}
-	return op
-}
-
-func (m *m19) guessOps() {
-	// Scrolling up to len(ram) is fine in the initial case, will need changing if re-running later
-	for addr := address(0); int(addr) < len(m.machine.ram); addr++ {
-		op := m.decodeAddress(addr)
-		if op == nil {
-			return
-		}
-		m19op := op.(*m19operation)
-
-		m.machine.ram[addr] = m19op
-		m.machine.operations[addr] = m19op
-		addr += address(m19op.numParams)
-	}
+// Day5 sets the behaviour of the intcode machine to the rules of AoC 2019 day 5
+func Day5(inputCallback InputCallback, outputCallback OutputCallback) MachineOption {
+	return WithModel(Day5Model, inputCallback, outputCallback)
 }
 
-type m19opMode int
-
 const (
-	m19opModePositional m19opMode = iota
-	m19opModeImmediate
-	m19opModeRelative
-)
-
-type m19operationCode int
-
-const (
-	m19OpNone m19operationCode = iota
+	m19OpNone = iota
 	m19OpAdd
 	m19OpMultiply
 	m19OpInput
@@ -185,143 +40,137 @@ const (
 	m19OpEqual
 	m19OpAdjustRelativeBase
 
-	m19OpHCF m19operationCode = 99
+	m19OpHCF = 99
 )
 
-type m19operation struct {
-	baseInteger *baseInteger
+var (
+	// Day2Model has only the add, multiply and halt instructions, with positional parameters
+	Day2Model = newBuiltinModel("D02", []ParamMode{ModePositional},
+		m19OpAdd, m19OpMultiply, m19OpHCF,
+	)
+	// Day5Model adds I/O, jumps and comparisons, and immediate parameters
+	Day5Model = newBuiltinModel("D05", []ParamMode{ModePositional, ModeImmediate},
+		m19OpAdd, m19OpMultiply, m19OpInput, m19OpOutput,
+		m19OpJumpTrue, m19OpJumpFalse, m19OpLess, m19OpEqual, m19OpHCF,
+	)
+	// M19Model is the complete AoC 2019 intcode machine, adding the relative base
+	M19Model = newBuiltinModel("M19", []ParamMode{ModePositional, ModeImmediate, ModeRelative},
+		m19OpAdd, m19OpMultiply, m19OpInput, m19OpOutput,
+		m19OpJumpTrue, m19OpJumpFalse, m19OpLess, m19OpEqual, m19OpAdjustRelativeBase, m19OpHCF,
+	)
+)
 
-	repr      string
-	numParams int
-	mode      []m19opMode
+// m19Opcodes defines every AoC 2019 instruction
+var m19Opcodes = map[int]Opcode{
+	m19OpAdd:                {m19OpAdd, "ADD", 3, 2, execAdd},
+	m19OpMultiply:           {m19OpMultiply, "MUL", 3, 2, execMultiply},
+	m19OpInput:              {m19OpInput, "INP", 1, 0, execInput},
+	m19OpOutput:             {m19OpOutput, "OUT", 1, -1, execOutput},
+	m19OpJumpTrue:           {m19OpJumpTrue, "JNZ", 2, -1, execJumpTrue},
+	m19OpJumpFalse:          {m19OpJumpFalse, "JEZ", 2, -1, execJumpFalse},
+	m19OpLess:               {m19OpLess, "CLT", 3, 2, execLess},
+	m19OpEqual:              {m19OpEqual, "CEQ", 3, 2, execEqual},
+	m19OpAdjustRelativeBase: {m19OpAdjustRelativeBase, "ARB", 1, -1, execAdjustRelativeBase},
+	m19OpHCF:                {m19OpHCF, "HCF", 0, -1, execHCF},
 }
 
-func (mo m19operation) Address() address { return mo.baseInteger.Address() }
-func (mo m19operation) Value() int       { return mo.baseInteger.Value() }
-func (mo *m19operation) Set(value int)   { mo.baseInteger.Set(value) }
+// newBuiltinModel creates and registers a model from a subset of the AoC 2019 instructions
+func newBuiltinModel(name string, modes []ParamMode, codes ...int) *InstructionSet {
+	s := NewInstructionSet(name, modes...)
+	for _, code := range codes {
+		if err := s.Register(m19Opcodes[code]); err != nil {
+			panic(err)
+		}
+	}
+	if err := RegisterModel(s); err != nil {
+		panic(err)
+	}
+	return s
+}
 
-func (mo m19operation) Name() string   { return mo.repr }
-func (mo m19operation) NumParams() int { return mo.numParams }
+// decodeM19 splits a raw instruction value into its definition and parameter modes
+func decodeM19(value int) (Opcode, []ParamMode, bool) {
+	return M19Model.split(value)
+}
 
-func (mo *m19operation) Exec() ExecReturnCode {
-	read := mo.baseInteger.machine.readAddress
-	write := mo.baseInteger.machine.writeAddress
-	paramAddresses := mo.getParamAddresses()
-	mo.baseInteger.machine.registers[RegisterInstructionPointer] += 1 + mo.numParams
-	op := m19operationCode(mo.baseInteger.Val % 100)
-	switch op {
-	case m19OpAdd:
-		a := read(paramAddresses[0]).Value()
-		b := read(paramAddresses[1]).Value()
-		newVal := a + b
+func execAdd(in *Instruction) (ExecReturnCode, error) {
+	return in.arithmetic(addInt, (*big.Int).Add)
+}
 
-		write(address(paramAddresses[2]), newVal)
-	case m19OpMultiply:
-		a := read(paramAddresses[0]).Value()
-		b := read(paramAddresses[1]).Value()
-		newVal := a * b
+func execMultiply(in *Instruction) (ExecReturnCode, error) {
+	return in.arithmetic(multiplyInt, (*big.Int).Mul)
+}
 
-		write(address(paramAddresses[2]), newVal)
-	case m19OpOutput:
-		newVal := read(paramAddresses[0]).Value()
-		mo.baseInteger.machine.setRegister(
-			M19RegisterOutput,
-			newVal,
-		)
-		if mo.baseInteger.machine.model.(*m19).outputCallback != nil {
-			mo.baseInteger.machine.model.(*m19).outputCallback(newVal)
-		}
-		return ExecRCInterrupt
-	case m19OpInput:
-		in, halt := mo.baseInteger.machine.model.(*m19).inputCallback()
-		if halt {
-			return ExecRCHCF
-		}
-		write(address(paramAddresses[0]), in)
-	case m19OpJumpTrue:
-		test := read(paramAddresses[0]).Value()
-		jmp := read(paramAddresses[1]).Value()
-		if test != 0 {
-			mo.baseInteger.machine.setRegister(RegisterInstructionPointer, jmp)
-		}
-	case m19OpJumpFalse:
-		test := read(paramAddresses[0]).Value()
-		jmp := read(paramAddresses[1]).Value()
-		if test == 0 {
-			mo.baseInteger.machine.setRegister(RegisterInstructionPointer, jmp)
-		}
-	case m19OpLess:
-		a := read(paramAddresses[0]).Value()
-		b := read(paramAddresses[1]).Value()
-		if a < b {
-			write(address(paramAddresses[2]), 1)
-		} else {
-			write(address(paramAddresses[2]), 0)
-		}
-	case m19OpEqual:
-		a := read(paramAddresses[0]).Value()
-		b := read(paramAddresses[1]).Value()
-		if a == b {
-			write(address(paramAddresses[2]), 1)
-		} else {
-			write(address(paramAddresses[2]), 0)
-		}
-	case m19OpAdjustRelativeBase:
-		value := read(paramAddresses[0]).Value()
-		mo.baseInteger.machine.registers[M19RelativeBase] += value
-	default:
-		return ExecRCInvalidInstruction
+func execInput(in *Instruction) (ExecReturnCode, error) {
+	value, rc := in.Input()
+	if rc != ExecRCNone {
+		return rc, nil
 	}
-	return ExecRCNone
+	in.Write(0, value)
+	return ExecRCNone, nil
 }
 
-func (mo *m19operation) getParamAddresses() []address {
-	addrs := make([]address, mo.numParams)
-
-	for i := 0; i < mo.numParams; i++ {
-		paramAddress := mo.baseInteger.address + address(i+1)
-		indirectAddress := address(mo.baseInteger.machine.readAddress(paramAddress).Value())
+func execOutput(in *Instruction) (ExecReturnCode, error) {
+	if !in.isBig(0) {
+		in.Output(in.Read(0))
+	} else if err := in.OutputBig(in.ReadBig(0)); err != nil {
+		return ExecRCInvalidInstruction, err
+	}
+	return ExecRCInterrupt, nil
+}
 
-		switch mo.mode[i] {
-		case m19opModeImmediate:
-			addrs[i] = paramAddress
-		case m19opModePositional:
-			addrs[i] = indirectAddress
-		case m19opModeRelative:
-			offset := mo.baseInteger.machine.Register(M19RelativeBase)
-			addrs[i] = indirectAddress + address(offset)
-		default:
-			panic("Unsupported mode")
-		}
+func execJumpTrue(in *Instruction) (ExecReturnCode, error) {
+	// Promoted values are never zero
+	test := in.Read(0) != 0 || in.isBig(0)
+	target, err := in.ReadInt(1)
+	if err != nil {
+		return ExecRCInvalidInstruction, err
 	}
+	if test {
+		in.Jump(target)
+	}
+	return ExecRCNone, nil
+}
 
-	return addrs
+func execJumpFalse(in *Instruction) (ExecReturnCode, error) {
+	test := in.Read(0) != 0 || in.isBig(0)
+	target, err := in.ReadInt(1)
+	if err != nil {
+		return ExecRCInvalidInstruction, err
+	}
+	if !test {
+		in.Jump(target)
+	}
+	return ExecRCNone, nil
 }
 
-func (mo *m19operation) writeToRAM(addr address, value int) {
-	mo.baseInteger.Set(value)
+func execLess(in *Instruction) (ExecReturnCode, error) {
+	if in.compare(0, 1) < 0 {
+		in.Write(2, 1)
+	} else {
+		in.Write(2, 0)
+	}
+	return ExecRCNone, nil
 }
 
-func (mo m19operation) String() string {
-	retString := ""
-	retString += fmt.Sprintf("%s", mo.repr)
-	for i := 0; i < mo.numParams; i++ {
-		paramAddress := mo.baseInteger.address + address(i+1)
-		paramInteger := mo.baseInteger.machine.readAddress(paramAddress)
+func execEqual(in *Instruction) (ExecReturnCode, error) {
+	if in.compare(0, 1) == 0 {
+		in.Write(2, 1)
+	} else {
+		in.Write(2, 0)
+	}
+	return ExecRCNone, nil
+}
 
-		switch mo.mode[i] {
-		case m19opModeImmediate:
-			retString = fmt.Sprintf("%s\t'%v'", retString, paramInteger)
-		case m19opModePositional:
-			dereferenced := mo.baseInteger.machine.readAddress(address(paramInteger.Value())).Value()
-			retString = fmt.Sprintf("%s\t#%v (%d)", retString, paramInteger, dereferenced)
-		case m19opModeRelative:
-			offset := mo.baseInteger.machine.Register(M19RelativeBase)
-			dereferenced := mo.baseInteger.machine.readAddress(address(paramInteger.Value() + offset)).Value()
-			retString = fmt.Sprintf("%s\t#%v+%v (%d)", retString, paramInteger, offset, dereferenced)
-		default:
-			retString = fmt.Sprintf("%s\t??'%v'", retString, paramInteger)
-		}
+func execAdjustRelativeBase(in *Instruction) (ExecReturnCode, error) {
+	adjustment, err := in.ReadInt(0)
+	if err != nil {
+		return ExecRCInvalidInstruction, err
 	}
-	return retString
+	in.SetRegister(M19RelativeBase, in.Machine().Register(M19RelativeBase)+adjustment)
+	return ExecRCNone, nil
+}
+
+func execHCF(in *Instruction) (ExecReturnCode, error) {
+	return ExecRCHCF, nil
 }
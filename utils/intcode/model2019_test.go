@@ -1,6 +1,7 @@
 package intcode
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -174,3 +175,47 @@ func TestSaveRestore(t *testing.T) {
 
 	assert.Equal(t, expected, outputs)
 }
+
+func TestNeedInput(t *testing.T) {
+	outputs := []int{}
+	m := NewMachine(M19(nil, func(out int) { outputs = append(outputs, out) }))
+	assert.NoError(t, m.LoadProgram("3,11,3,12,1,11,12,13,4,13,99,0,0,0"))
+
+	assert.Equal(t, ExecRCNeedInput, m.Step())
+	assert.Equal(t, 0, m.Register(RegisterInstructionPointer))
+	assert.Equal(t, 0, m.InstructionCount())
+
+	m.QueueInput(3)
+	reason, err := m.RunFor(0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, StopNeedInput, reason)
+	assert.Equal(t, 2, m.Register(RegisterInstructionPointer))
+	assert.Equal(t, 1, m.InstructionCount())
+
+	m.QueueInput(4)
+	m.Run(false)
+	assert.Equal(t, []int{7}, outputs)
+	assert.Equal(t, 5, m.InstructionCount())
+}
+
+func TestQueueInputBeforeCallback(t *testing.T) {
+	outputs := []int{}
+	inputCB := func() (int, bool) { return 10, false }
+	m := NewMachine(M19(inputCB, func(out int) { outputs = append(outputs, out) }))
+	assert.NoError(t, m.LoadProgram("3,0,4,0,3,0,4,0,99"))
+	m.QueueInput(1)
+	m.Run(false)
+	assert.Equal(t, []int{1, 10}, outputs)
+}
+
+func TestWriteMemory(t *testing.T) {
+	m := NewMachine(Day2())
+	assert.NoError(t, m.LoadProgram("1,0,0,0,99"))
+	assert.NoError(t, m.WriteMemory(map[int]int{1: 4, 2: 4}))
+	m.Run(false)
+	assert.Equal(t, 198, m.ReadRAM(0))
+
+	err := m.WriteMemory(map[int]int{3: 1, -1: 1})
+	assert.True(t, errors.Is(err, ErrNegativeAddress))
+	assert.Equal(t, 0, m.ReadRAM(3))
+}
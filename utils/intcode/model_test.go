@@ -0,0 +1,122 @@
+package intcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinModels(t *testing.T) {
+	type testDef struct {
+		option  MachineOption
+		program string
+		err     error
+	}
+	tests := []testDef{
+		testDef{Day2(), "1,0,0,0,99", nil},
+		testDef{Day2(), "3,0,99", ErrInvalidOpcode},
+		testDef{Day2(), "1101,1,1,0,99", ErrInvalidMode},
+		testDef{Day5(nil, nil), "1101,1,1,0,99", nil},
+		testDef{Day5(nil, nil), "109,1,99", ErrInvalidOpcode},
+		testDef{Day5(nil, nil), "2201,1,1,0,99", ErrInvalidMode},
+		testDef{M19(nil, nil), "109,1,2201,1,1,0,99", nil},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			m := NewMachine(test.option)
+			assert.NoError(t, m.LoadProgram(test.program))
+			rc, err := m.TryRun(false)
+			if test.err == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, ExecRCHCF, rc)
+			} else {
+				assert.True(t, errors.Is(err, test.err), "Expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCustomModel(t *testing.T) {
+	square := Opcode{
+		Code:       10,
+		Name:       "SQR",
+		NumParams:  2,
+		WriteParam: 1,
+		Exec: func(in *Instruction) (ExecReturnCode, error) {
+			value := in.Read(0)
+			in.Write(1, value*value)
+			return ExecRCNone, nil
+		},
+	}
+	custom, err := M19Model.Extend("M19SQR", square)
+	assert.NoError(t, err)
+	assert.Equal(t, "M19SQR", custom.Name())
+	assert.Len(t, custom.Opcodes(), len(M19Model.Opcodes())+1)
+	_, found := M19Model.Lookup(10)
+	assert.False(t, found)
+
+	outputs := []int{}
+	m := NewMachine(WithModel(custom, nil, func(value int) { outputs = append(outputs, value) }))
+	assert.NoError(t, m.LoadProgram("110,7,8,4,8,99,0,0,0"))
+	m.Run(false)
+	assert.Equal(t, []int{49}, outputs)
+
+	snapshot := m.Snapshot()
+	assert.Equal(t, "M19SQR", snapshot.Model)
+	_, err = DiffSnapshots(snapshot, snapshot)
+	assert.Error(t, err)
+	assert.NoError(t, RegisterModel(custom))
+	_, err = DiffSnapshots(snapshot, snapshot)
+	assert.NoError(t, err)
+	assert.Error(t, RegisterModel(custom))
+	model, found := LookupModel("M19SQR")
+	assert.True(t, found)
+	assert.Equal(t, custom, model)
+}
+
+func TestRegisterOpcodeErrors(t *testing.T) {
+	nop := func(in *Instruction) (ExecReturnCode, error) { return ExecRCNone, nil }
+	type testDef struct {
+		opcode Opcode
+		err    string
+	}
+	tests := []testDef{
+		testDef{Opcode{0, "NOP", 0, -1, nop}, "Cannot register NOP: opcode 0 out of range"},
+		testDef{Opcode{100, "NOP", 0, -1, nop}, "Cannot register NOP: opcode 100 out of range"},
+		testDef{Opcode{10, "", 0, -1, nop}, "Cannot register opcode 10: no name"},
+		testDef{Opcode{10, "NOP", 0, -1, nil}, "Cannot register NOP: no Exec function"},
+		testDef{Opcode{10, "NOP", 1, 1, nop}, "Cannot register NOP: invalid parameters"},
+		testDef{Opcode{1, "NOP", 0, -1, nop}, "Cannot register NOP: opcode 1 already registered"},
+		testDef{Opcode{10, "ADD", 0, -1, nop}, "Cannot register ADD: name already registered"},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			_, err := M19Model.Extend("M19X", test.opcode)
+			assert.EqualError(t, err, test.err)
+		})
+	}
+
+	s := NewInstructionSet("Empty", ModePositional)
+	assert.Error(t, s.Register(Opcode{10, "NOP", 0, -1, nop}, Opcode{10, "NOP2", 0, -1, nop}))
+	assert.Empty(t, s.Opcodes())
+}
+
+func TestSealedInstructionSet(t *testing.T) {
+	nop := Opcode{10, "NOP", 0, -1, func(in *Instruction) (ExecReturnCode, error) { return ExecRCNone, nil }}
+	for _, builtin := range []*InstructionSet{Day2Model, Day5Model, M19Model} {
+		assert.EqualError(t, builtin.Register(nop), fmt.Sprintf("Cannot register opcodes with %s: instruction set is in use (try Extend)", builtin.Name()))
+		_, found := builtin.Lookup(10)
+		assert.False(t, found)
+	}
+
+	s := NewInstructionSet("Sealed", ModePositional)
+	assert.NoError(t, s.Register(nop))
+	NewMachine(WithModel(s, nil, nil))
+	assert.Error(t, s.Register(Opcode{11, "NOP2", 0, -1, nop.Exec}))
+	extended, err := s.Extend("Extended", Opcode{11, "NOP2", 0, -1, nop.Exec})
+	assert.NoError(t, err)
+	assert.Len(t, extended.Opcodes(), 2)
+	assert.NoError(t, extended.Register(Opcode{12, "NOP3", 0, -1, nop.Exec}))
+}
@@ -0,0 +1,217 @@
+package intcode
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+// OverflowMode selects what happens when an arithmetic result does not fit in an int
+type OverflowMode int
+
+const (
+	// OverflowWrap silently wraps results, as native int arithmetic does
+	OverflowWrap OverflowMode = iota
+	// OverflowError fails the instruction with ErrOverflow
+	OverflowError
+	// OverflowPromote stores the exact result as a *big.Int
+	OverflowPromote
+)
+
+func (o OverflowMode) String() string {
+	switch o {
+	case OverflowWrap:
+		return "wrap"
+	case OverflowError:
+		return "error"
+	case OverflowPromote:
+		return "promote"
+	}
+	return fmt.Sprintf("OverflowMode(%d)", int(o))
+}
+
+// BigOutputCallback is called with output values which do not fit in an int
+type BigOutputCallback func(*big.Int)
+
+// Overflow sets how the machine handles arithmetic results which do not fit in an int
+//
+// With OverflowPromote, cells holding promoted values report the wrapped value through ReadRAM,
+// Memory and the other int based APIs, and their exact value through ReadBig. Promoted values
+// cannot be used as addresses, jump targets or relative base adjustments.
+func Overflow(mode OverflowMode) MachineOption {
+	return func(m *Machine) {
+		m.overflow = mode
+	}
+}
+
+// BigOutput sets a callback to receive output values which do not fit in an int
+//
+// Without one, outputting such a value fails with ErrOverflow.
+func BigOutput(callback BigOutputCallback) MachineOption {
+	return func(m *Machine) {
+		m.bigOutput = callback
+	}
+}
+
+// ReadBig returns the exact value at a given address
+func (m Machine) ReadBig(addr address) *big.Int {
+	if value, found := m.bigValues[addr]; found {
+		return new(big.Int).Set(value)
+	}
+	return big.NewInt(int64(m.readAddress(addr)))
+}
+
+// WriteBig stores an exact value at a given address
+//
+// Values which do not fit in an int are wrapped unless the machine uses OverflowPromote.
+func (m Machine) WriteBig(addr address, value *big.Int) {
+	m.WriteRAM(addr, wrapBig(value))
+	if !value.IsInt64() && m.overflow == OverflowPromote {
+		m.setBig(addr, value)
+	}
+}
+
+// setBig records the exact value of a cell which already holds its wrapped value
+func (m *Machine) setBig(addr address, value *big.Int) {
+	if _, mapped := m.device(addr); mapped {
+		return
+	}
+	if m.bigValues == nil {
+		m.bigValues = map[address]*big.Int{}
+	}
+	m.bigValues[addr] = new(big.Int).Set(value)
+}
+
+// wrapBig truncates a value to an int, as native arithmetic would
+func wrapBig(value *big.Int) int {
+	if value.IsInt64() {
+		return int(value.Int64())
+	}
+	wrapped := new(big.Int).And(value, new(big.Int).SetUint64(^uint64(0)))
+	return int(int64(wrapped.Uint64()))
+}
+
+// isBig reports whether a parameter refers to a promoted value
+func (in *Instruction) isBig(param int) bool {
+	_, found := in.binding.machine.bigValues[in.params[param]]
+	return found
+}
+
+// ReadBig loads the exact value of a parameter, counting from 0
+func (in *Instruction) ReadBig(param int) *big.Int {
+	return in.exactValue(param, in.Read(param))
+}
+
+// exactValue finds the exact value of a parameter which has already been read
+func (in *Instruction) exactValue(param int, value int) *big.Int {
+	if exact, found := in.binding.machine.bigValues[in.params[param]]; found {
+		return new(big.Int).Set(exact)
+	}
+	return big.NewInt(int64(value))
+}
+
+// WriteBig stores an exact value at the address of a parameter, counting from 0, according to
+// the machine's OverflowMode
+//
+// An *ExecError is returned if the value does not fit in an int and the mode is OverflowError.
+func (in *Instruction) WriteBig(param int, value *big.Int) error {
+	machine := in.binding.machine
+	if !value.IsInt64() && machine.overflow == OverflowError {
+		return in.overflowError(param)
+	}
+	in.Write(param, wrapBig(value))
+	if !value.IsInt64() && machine.overflow == OverflowPromote {
+		machine.setBig(in.params[param], value)
+	}
+	return nil
+}
+
+// ReadInt loads the value of a parameter, counting from 0, failing if it has been promoted
+func (in *Instruction) ReadInt(param int) (int, error) {
+	value := in.Read(param)
+	if in.isBig(param) {
+		return 0, in.overflowError(param)
+	}
+	return value, nil
+}
+
+// OutputBig outputs an exact value, passing it to the BigOutput callback if it does not fit in an
+// int
+//
+// An *ExecError is returned if there is no BigOutput callback for such a value.
+func (in *Instruction) OutputBig(value *big.Int) error {
+	if value.IsInt64() {
+		in.Output(int(value.Int64()))
+		return nil
+	}
+	machine := in.binding.machine
+	if machine.bigOutput == nil {
+		return in.overflowError(0)
+	}
+	in.SetRegister(M19RegisterOutput, wrapBig(value))
+	if !machine.history.replaying(machine.instructionCount) {
+		machine.bigOutput(value)
+	}
+	return nil
+}
+
+// overflowError fails the instruction, returning the instruction pointer to it so that the
+// machine is unchanged
+func (in *Instruction) overflowError(param int) error {
+	in.Jump(int(in.address))
+	return in.execError(ErrOverflow, param+1)
+}
+
+// arithmetic combines the first two parameters, writing the result to the third
+//
+// small computes the result natively, reporting whether it is exact, and large is used for
+// promoted values.
+func (in *Instruction) arithmetic(small func(a, b int) (int, bool), large func(z, a, b *big.Int) *big.Int) (ExecReturnCode, error) {
+	a, b := in.Read(0), in.Read(1)
+	if !in.isBig(0) && !in.isBig(1) {
+		result, exact := small(a, b)
+		if exact || in.binding.machine.overflow == OverflowWrap {
+			in.Write(2, result)
+			return ExecRCNone, nil
+		}
+	}
+	result := large(new(big.Int), in.exactValue(0, a), in.exactValue(1, b))
+	if err := in.WriteBig(2, result); err != nil {
+		return ExecRCInvalidInstruction, err
+	}
+	return ExecRCNone, nil
+}
+
+// compare orders the values of two parameters
+func (in *Instruction) compare(a, b int) int {
+	x, y := in.Read(a), in.Read(b)
+	if in.isBig(a) || in.isBig(b) {
+		return in.exactValue(a, x).Cmp(in.exactValue(b, y))
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func addInt(a, b int) (int, bool) {
+	sum := a + b
+	return sum, (sum > a) == (b > 0)
+}
+
+// minInt is the most negative int, which cannot be negated
+const minInt = -1 << (bits.UintSize - 1)
+
+func multiplyInt(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	product := a * b
+	if (a == -1 && b == minInt) || (b == -1 && a == minInt) {
+		return product, false
+	}
+	return product, product/b == a
+}
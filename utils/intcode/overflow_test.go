@@ -0,0 +1,126 @@
+package intcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverflow(t *testing.T) {
+	// Squares 2^32 and outputs the result, then compares it with 0
+	program := fmt.Sprintf("1002,13,%d,13,4,13,1007,13,0,14,4,14,99,%d,0", 1<<32, 1<<32)
+	exact := new(big.Int).Lsh(big.NewInt(1), 64)
+
+	type testDef struct {
+		mode    OverflowMode
+		outputs []int
+		big     []*big.Int
+		err     error
+	}
+	tests := []testDef{
+		testDef{mode: OverflowWrap, outputs: []int{0, 0}},
+		testDef{mode: OverflowError, err: ErrOverflow},
+		testDef{mode: OverflowPromote, outputs: []int{0}, big: []*big.Int{exact}},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			outputs := []int{}
+			bigOutputs := []*big.Int{}
+			m := NewMachine(
+				M19(nil, func(value int) { outputs = append(outputs, value) }),
+				Overflow(test.mode),
+				BigOutput(func(value *big.Int) { bigOutputs = append(bigOutputs, value) }),
+			)
+			assert.NoError(t, m.LoadProgram(program))
+			_, err := m.TryRun(false)
+			if test.err != nil {
+				assert.True(t, errors.Is(err, test.err))
+				assert.Equal(t, 0, m.Register(RegisterInstructionPointer))
+				assert.Equal(t, 1<<32, m.ReadRAM(13))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.outputs, outputs)
+			assert.Equal(t, len(test.big), len(bigOutputs))
+			for i := range test.big {
+				assert.Equal(t, 0, test.big[i].Cmp(bigOutputs[i]))
+			}
+		})
+	}
+}
+
+func TestOverflowArithmetic(t *testing.T) {
+	type testDef struct {
+		a, b    int
+		add     bool
+		product bool
+	}
+	tests := []testDef{
+		testDef{1, 2, true, true},
+		testDef{math.MaxInt64, 1, false, true},
+		testDef{math.MinInt64, -1, false, false},
+		testDef{-1, math.MinInt64, false, false},
+		testDef{math.MaxInt64, 2, false, false},
+		testDef{-math.MaxInt64, -1, true, true},
+		testDef{1 << 31, 1 << 31, true, true},
+		testDef{1 << 32, 1 << 31, true, false},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			_, exact := addInt(test.a, test.b)
+			assert.Equal(t, test.add, exact)
+			_, exact = multiplyInt(test.a, test.b)
+			assert.Equal(t, test.product, exact)
+		})
+	}
+}
+
+func TestOverflowPromote(t *testing.T) {
+	m := NewMachine(M19(nil, nil), Overflow(OverflowPromote))
+	// Adds two promoted values, then jumps to one of them
+	assert.NoError(t, m.LoadProgram("1,9,10,11,105,1,11,99,0,0,0,0"))
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	m.WriteBig(9, huge)
+	m.WriteBig(10, huge)
+	assert.Equal(t, wrapBig(huge), m.ReadRAM(9))
+
+	_, err := m.TryRun(false)
+	assert.True(t, errors.Is(err, ErrOverflow))
+	assert.Equal(t, 4, m.Register(RegisterInstructionPointer))
+	assert.Equal(t, new(big.Int).Add(huge, huge), m.ReadBig(11))
+
+	buffer := &bytes.Buffer{}
+	assert.NoError(t, m.Snapshot().Encode(buffer, SnapshotBinary))
+	wrapping := NewMachine(M19(nil, nil))
+	assert.EqualError(t, wrapping.TryRestore(buffer.Bytes()), "Cannot restore machine: snapshot has overflow mode promote, not wrap")
+	restored := NewMachine(M19(nil, nil), Overflow(OverflowPromote))
+	assert.NoError(t, restored.TryRestore(buffer.Bytes()))
+	assert.Equal(t, m.ReadBig(11), restored.ReadBig(11))
+	assert.Equal(t, m.ReadRAM(11), restored.ReadRAM(11))
+
+	clone := m.Clone()
+	clone.WriteRAM(11, 5)
+	assert.Equal(t, big.NewInt(5), clone.ReadBig(11))
+	assert.Equal(t, new(big.Int).Add(huge, huge), m.ReadBig(11))
+}
+
+func TestOverflowPromoteHistory(t *testing.T) {
+	m := NewMachine(M19(nil, nil), Overflow(OverflowPromote), History(10, 0, 0))
+	// Adds two promoted values, then overwrites the sum
+	assert.NoError(t, m.LoadProgram("1,12,13,11,1101,1,1,11,99,0,0,0,0,0"))
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	m.WriteBig(12, huge)
+	m.WriteBig(13, huge)
+	m.Run(false)
+	assert.Equal(t, big.NewInt(2), m.ReadBig(11))
+
+	assert.NoError(t, m.StepBack(2))
+	assert.Equal(t, new(big.Int).Add(huge, huge), m.ReadBig(11))
+	assert.NoError(t, m.StepBack(1))
+	assert.Equal(t, big.NewInt(0), m.ReadBig(11))
+}
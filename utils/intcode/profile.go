@@ -0,0 +1,427 @@
+package intcode
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Profiler counts the instructions executed by a machine, by address, opcode and subroutine
+//
+// Subroutines are recognised by the calling convention of compiled intcode: a jump landing on an
+// instruction which increases the relative base enters a subroutine, and a jump taken once the
+// relative base is back to its value before the call returns from it.
+type Profiler struct {
+	nopHook
+	machine *Machine
+
+	total     int
+	addresses map[address]int
+	opcodes   map[string]int
+	functions map[address]*SubroutineProfile
+	// owners records the subroutine each executed address was first seen in
+	owners map[address]address
+
+	stack    []profileFrame
+	stackKey string
+	// stacks holds the call sites, innermost first, of each stack key
+	stacks  map[string][]address
+	samples map[profileSample]int
+
+	ip       address
+	op       operation
+	rbBefore int
+	prevIP   address
+	jumped   bool
+}
+
+// SubroutineProfile summarises the instructions executed by a subroutine
+type SubroutineProfile struct {
+	// Entry is the address of the first instruction, or -1 for code outside any subroutine
+	Entry int
+	Calls int
+	// Instructions counts instructions executed by the subroutine itself, excluding its callees
+	Instructions int
+}
+
+type profileFrame struct {
+	entry    address
+	callSite address
+	rb       int
+}
+
+type profileSample struct {
+	stack string
+	ip    address
+}
+
+// topLevel is the entry recorded for code outside any subroutine
+const topLevel = address(-1)
+
+// NewProfiler attaches a profiler to a machine
+func NewProfiler(m *Machine) *Profiler {
+	p := &Profiler{
+		machine:   m,
+		addresses: map[address]int{},
+		opcodes:   map[string]int{},
+		functions: map[address]*SubroutineProfile{topLevel: {Entry: -1}},
+		owners:    map[address]address{},
+		stacks:    map[string][]address{"": nil},
+		samples:   map[profileSample]int{},
+	}
+	m.addHook(p)
+	return p
+}
+
+// Detach removes the profiler from the machine
+func (p *Profiler) Detach() {
+	p.machine.removeHook(p)
+}
+
+func (p *Profiler) beforeStep(ip address, op operation) {
+	p.ip = ip
+	p.op = op
+	p.rbBefore = p.machine.registers[M19RelativeBase]
+}
+
+func (p *Profiler) afterStep(rc ExecReturnCode) {
+	if p.op == nil || rc == ExecRCInvalidInstruction || rc == ExecRCNeedInput {
+		return
+	}
+	rb := p.machine.registers[M19RelativeBase]
+	if p.jumped && rb > p.rbBefore {
+		p.stack = append(p.stack, profileFrame{entry: p.ip, callSite: p.prevIP, rb: p.rbBefore})
+		p.updateStackKey()
+		function, found := p.functions[p.ip]
+		if !found {
+			function = &SubroutineProfile{Entry: int(p.ip)}
+			p.functions[p.ip] = function
+		}
+		function.Calls++
+	}
+
+	entry := p.currentEntry()
+	p.total++
+	p.addresses[p.ip]++
+	p.opcodes[p.op.Name()]++
+	p.functions[entry].Instructions++
+	if _, found := p.owners[p.ip]; !found {
+		p.owners[p.ip] = entry
+	}
+	p.samples[profileSample{p.stackKey, p.ip}]++
+
+	p.prevIP = p.ip
+	p.jumped = address(p.machine.registers[RegisterInstructionPointer]) != p.ip+address(1+p.op.NumParams())
+	if p.jumped && len(p.stack) > 0 && rb <= p.stack[len(p.stack)-1].rb {
+		for len(p.stack) > 0 && rb <= p.stack[len(p.stack)-1].rb {
+			p.stack = p.stack[:len(p.stack)-1]
+		}
+		p.updateStackKey()
+	}
+}
+
+func (p *Profiler) currentEntry() address {
+	if len(p.stack) == 0 {
+		return topLevel
+	}
+	return p.stack[len(p.stack)-1].entry
+}
+
+func (p *Profiler) updateStackKey() {
+	sites := make([]string, len(p.stack))
+	callSites := make([]address, len(p.stack))
+	for i, frame := range p.stack {
+		sites[i] = fmt.Sprintf("%d", frame.callSite)
+		callSites[len(p.stack)-1-i] = frame.callSite
+	}
+	p.stackKey = strings.Join(sites, ",")
+	if _, found := p.stacks[p.stackKey]; !found {
+		p.stacks[p.stackKey] = callSites
+	}
+}
+
+// Total returns the number of instructions executed while profiling
+func (p *Profiler) Total() int {
+	return p.total
+}
+
+// AddressCounts returns the number of times each address was executed
+func (p *Profiler) AddressCounts() map[int]int {
+	counts := make(map[int]int, len(p.addresses))
+	for addr, count := range p.addresses {
+		counts[int(addr)] = count
+	}
+	return counts
+}
+
+// OpcodeCounts returns the number of times each instruction was executed, by mnemonic
+func (p *Profiler) OpcodeCounts() map[string]int {
+	counts := make(map[string]int, len(p.opcodes))
+	for name, count := range p.opcodes {
+		counts[name] = count
+	}
+	return counts
+}
+
+// Subroutines summarises each subroutine called, and the code outside them, by instructions
+// executed
+func (p *Profiler) Subroutines() []SubroutineProfile {
+	subroutines := make([]SubroutineProfile, 0, len(p.functions))
+	for _, function := range p.functions {
+		subroutines = append(subroutines, *function)
+	}
+	sort.Slice(subroutines, func(i, j int) bool {
+		if subroutines[i].Instructions != subroutines[j].Instructions {
+			return subroutines[i].Instructions > subroutines[j].Instructions
+		}
+		return subroutines[i].Entry < subroutines[j].Entry
+	})
+	return subroutines
+}
+
+// hotAddresses lists executed addresses, most executed first
+func (p *Profiler) hotAddresses() []address {
+	addrs := make([]address, 0, len(p.addresses))
+	for addr := range p.addresses {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if p.addresses[addrs[i]] != p.addresses[addrs[j]] {
+			return p.addresses[addrs[i]] > p.addresses[addrs[j]]
+		}
+		return addrs[i] < addrs[j]
+	})
+	return addrs
+}
+
+// Report writes the top most executed addresses, with their disassembly, followed by instruction
+// counts by opcode and subroutine
+func (p *Profiler) Report(w io.Writer, top int) error {
+	hot := p.hotAddresses()
+	if top > 0 && len(hot) > top {
+		hot = hot[:top]
+	}
+	entryPoints := make([]int, len(hot))
+	for i, addr := range hot {
+		entryPoints[i] = int(addr)
+	}
+	code := p.machine.Disassemble(entryPoints...)
+
+	lines := []string{fmt.Sprintf("Total instructions: %d", p.total), "", "Hot addresses:"}
+	for _, addr := range hot {
+		instruction := code.instructionAt(int(addr))
+		if instruction == "" {
+			instruction = "??"
+		}
+		lines = append(lines, fmt.Sprintf("%10d %6.2f%%  %v  %s", p.addresses[addr], p.percent(p.addresses[addr]), addr, instruction))
+	}
+
+	names := make([]string, 0, len(p.opcodes))
+	for name := range p.opcodes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if p.opcodes[names[i]] != p.opcodes[names[j]] {
+			return p.opcodes[names[i]] > p.opcodes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	lines = append(lines, "", "Opcodes:")
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%10d %6.2f%%  %s", p.opcodes[name], p.percent(p.opcodes[name]), name))
+	}
+
+	lines = append(lines, "", "Subroutines:")
+	for _, function := range p.Subroutines() {
+		if function.Instructions == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%10d %6.2f%%  %-6s %d calls",
+			function.Instructions, p.percent(function.Instructions), functionName(address(function.Entry)), function.Calls,
+		))
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+func (p *Profiler) percent(count int) float64 {
+	if p.total == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(p.total)
+}
+
+// functionName names a subroutine in reports, matching the labels used by the disassembler
+func functionName(entry address) string {
+	if entry == topLevel {
+		return "main"
+	}
+	return fmt.Sprintf("L%04d", entry)
+}
+
+// WritePprof writes the profile in the gzipped protocol buffer format read by go tool pprof
+//
+// Each intcode address is reported as a location within the subroutine it was executed in, with
+// its address as the line number.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	strs := newStringTable()
+	profile := &protoBuffer{}
+
+	instructions, count := strs.index("instructions"), strs.index("count")
+	profile.message(1, func(b *protoBuffer) {
+		b.varint(1, uint64(instructions))
+		b.varint(2, uint64(count))
+	})
+
+	keys := make([]profileSample, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].stack != keys[j].stack {
+			return keys[i].stack < keys[j].stack
+		}
+		return keys[i].ip < keys[j].ip
+	})
+	locationID := func(addr address) uint64 { return uint64(addr) + 1 }
+	maxAddress := address(0)
+	for _, key := range keys {
+		stack := []uint64{locationID(key.ip)}
+		for _, site := range p.stacks[key.stack] {
+			stack = append(stack, locationID(site))
+		}
+		value := uint64(p.samples[key])
+		profile.message(2, func(b *protoBuffer) {
+			b.packed(1, stack)
+			b.packed(2, []uint64{value})
+		})
+		if key.ip > maxAddress {
+			maxAddress = key.ip
+		}
+	}
+
+	filename := strs.index("intcode")
+	profile.message(3, func(b *protoBuffer) {
+		b.varint(1, 1)
+		b.varint(3, uint64(maxAddress)+1)
+		b.varint(5, uint64(filename))
+		b.varint(7, 1)
+	})
+
+	functionIDs := map[address]uint64{}
+	addrs := make([]address, 0, len(p.owners))
+	for addr, entry := range p.owners {
+		addrs = append(addrs, addr)
+		if _, found := functionIDs[entry]; !found {
+			functionIDs[entry] = uint64(entry) + 2
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	for _, addr := range addrs {
+		function := functionIDs[p.owners[addr]]
+		line := uint64(addr)
+		profile.message(4, func(b *protoBuffer) {
+			b.varint(1, locationID(addr))
+			b.varint(2, 1)
+			b.varint(3, uint64(addr))
+			b.message(4, func(b *protoBuffer) {
+				b.varint(1, function)
+				b.varint(2, line)
+			})
+		})
+	}
+
+	entries := make([]address, 0, len(functionIDs))
+	for entry := range functionIDs {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i] < entries[j] })
+	for _, entry := range entries {
+		name := strs.index(functionName(entry))
+		start := uint64(0)
+		if entry != topLevel {
+			start = uint64(entry)
+		}
+		profile.message(5, func(b *protoBuffer) {
+			b.varint(1, functionIDs[entry])
+			b.varint(2, uint64(name))
+			b.varint(3, uint64(name))
+			b.varint(4, uint64(filename))
+			b.varint(5, start)
+		})
+	}
+
+	for _, str := range strs.strings {
+		profile.bytes(6, []byte(str))
+	}
+	profile.message(11, func(b *protoBuffer) {
+		b.varint(1, uint64(instructions))
+		b.varint(2, uint64(count))
+	})
+	profile.varint(12, 1)
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// stringTable deduplicates the strings referenced by a pprof profile
+type stringTable struct {
+	strings []string
+	indices map[string]int
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indices: map[string]int{"": 0}}
+}
+
+func (t *stringTable) index(str string) int {
+	if i, found := t.indices[str]; found {
+		return i
+	}
+	t.indices[str] = len(t.strings)
+	t.strings = append(t.strings, str)
+	return t.indices[str]
+}
+
+// protoBuffer encodes protocol buffer messages
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) rawVarint(value uint64) {
+	for value >= 0x80 {
+		b.data = append(b.data, byte(value)|0x80)
+		value >>= 7
+	}
+	b.data = append(b.data, byte(value))
+}
+
+func (b *protoBuffer) varint(field int, value uint64) {
+	b.rawVarint(uint64(field) << 3)
+	b.rawVarint(value)
+}
+
+func (b *protoBuffer) bytes(field int, value []byte) {
+	b.rawVarint(uint64(field)<<3 | 2)
+	b.rawVarint(uint64(len(value)))
+	b.data = append(b.data, value...)
+}
+
+func (b *protoBuffer) packed(field int, values []uint64) {
+	inner := &protoBuffer{}
+	for _, value := range values {
+		inner.rawVarint(value)
+	}
+	b.bytes(field, inner.data)
+}
+
+func (b *protoBuffer) message(field int, encode func(*protoBuffer)) {
+	inner := &protoBuffer{}
+	encode(inner)
+	b.bytes(field, inner.data)
+}
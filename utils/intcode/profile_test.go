@@ -0,0 +1,101 @@
+package intcode
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const profileTestSource = `
+	        ARB  stack
+	        ADD  ret1, 0, [rb]
+	        JNZ  1, count
+	ret1:   ADD  ret2, 0, [rb]
+	        JNZ  1, count
+	ret2:   OUT  [calls]
+	        HCF
+	count:  ARB  2
+	        ADD  [calls], 1, [calls]
+	        ARB  -2
+	        JNZ  1, [rb]
+	calls:  DATA 0
+	stack:  DATA 0
+`
+
+func TestProfiler(t *testing.T) {
+	program, err := Assemble(profileTestSource)
+	assert.NoError(t, err)
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram(program))
+	p := NewProfiler(&m)
+	m.Run(false)
+
+	assert.Equal(t, 15, p.Total())
+	assert.Equal(t, map[string]int{"ARB": 5, "ADD": 4, "JNZ": 4, "OUT": 1, "HCF": 1}, p.OpcodeCounts())
+	assert.Equal(t, 2, p.AddressCounts()[19])
+	assert.Equal(t, 1, p.AddressCounts()[0])
+	assert.Equal(t, []SubroutineProfile{
+		{Entry: 19, Calls: 2, Instructions: 8},
+		{Entry: -1, Calls: 0, Instructions: 7},
+	}, p.Subroutines())
+
+	report := &bytes.Buffer{}
+	assert.NoError(t, p.Report(report, 2))
+	assert.True(t, strings.HasPrefix(report.String(), "Total instructions: 15\n\nHot addresses:\n"+
+		"         2  13.33%  #0019  ARB  2\n"+
+		"         2  13.33%  #0021  ADD  [30], 1, [30]\n\n"+
+		"Opcodes:\n"+
+		"         5  33.33%  ARB\n",
+	), report.String())
+	assert.Contains(t, report.String(), "Subroutines:\n"+
+		"         8  53.33%  L0019  2 calls\n"+
+		"         7  46.67%  main   0 calls\n",
+	)
+
+	assert.Equal(t, map[string]string{"L0019": "8", "main": "7"}, pprofTop(t, p))
+
+	p.Detach()
+	m.WriteRAM(address(m.Register(RegisterInstructionPointer)), 99)
+	m.Run(false)
+	assert.Equal(t, 15, p.Total())
+}
+
+// pprofTop writes a profile and reads it back with go tool pprof, returning the flat instruction
+// count of each function
+func pprofTop(t *testing.T, p *Profiler) map[string]string {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	dir, err := ioutil.TempDir("", "intcode-profile")
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "profile.pb.gz")
+	profile := &bytes.Buffer{}
+	assert.NoError(t, p.WritePprof(profile))
+	assert.NoError(t, ioutil.WriteFile(file, profile.Bytes(), 0644))
+
+	out, err := exec.Command(goTool, "tool", "pprof", "-top", file).CombinedOutput()
+	if !assert.NoError(t, err, string(out)) {
+		return nil
+	}
+	assert.Contains(t, string(out), "Type: instructions\n")
+	assert.Contains(t, string(out), fmt.Sprintf("of %d total", p.Total()))
+	flat := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 6 && strings.HasSuffix(fields[1], "%") {
+			flat[fields[5]] = fields[0]
+		}
+	}
+	return flat
+}
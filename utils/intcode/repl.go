@@ -0,0 +1,427 @@
+package intcode
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// REPL runs a program interactively, passing each line typed at it to the program as ASCII input
+//
+// Lines starting with ':' are meta-commands which inspect and control the machine instead. A line
+// starting with "::" is passed to the program without its first ':'.
+type REPL struct {
+	// MaxInstructions limits each run of the program between inputs, or 0 for no limit
+	MaxInstructions int
+
+	machine Machine
+	out     io.Writer
+	stopped StopReason
+	// interrupts stop a running program, as passed to Run
+	interrupts <-chan os.Signal
+
+	snapshots map[string]replSnapshot
+	history   []string
+	tracer    *tracer
+	replaying map[string]bool
+}
+
+// replSnapshot is a snapshot kept by name, with the input history which led to it
+type replSnapshot struct {
+	snapshot *Snapshot
+	history  []string
+	stopped  StopReason
+}
+
+// NewREPL creates a REPL running a copy of m, writing output to out
+//
+// ASCII output is written as characters, and other values as numbers on lines of their own. Hooks
+// are not copied to the REPL's machine, as with Clone.
+func NewREPL(m *Machine, out io.Writer) (*REPL, error) {
+	binding, ok := m.model.(*modelBinding)
+	if !ok {
+		return nil, fmt.Errorf("Cannot start REPL: No intcode machine model defined")
+	}
+	numeric := func(value int) { fmt.Fprintln(out, value) }
+	r := &REPL{
+		machine:   m.Clone(WithModel(binding.model, nil, WriterOutput(out, numeric))),
+		out:       out,
+		stopped:   StopNeedInput,
+		snapshots: map[string]replSnapshot{},
+		replaying: map[string]bool{},
+	}
+	r.machine.model.(*modelBinding).decodeOps = binding.decodeOps
+	return r, nil
+}
+
+// Machine returns the machine run by the REPL
+func (r *REPL) Machine() *Machine {
+	return &r.machine
+}
+
+// History returns the lines input to the program so far
+func (r *REPL) History() []string {
+	return append([]string{}, r.history...)
+}
+
+const replHelp = `Lines are input to the program, other than these commands:
+  :save NAME               keep a snapshot of the machine
+  :restore NAME            return to a snapshot, along with the input history which led to it
+  :snapshots               list the snapshots kept
+  :export FILE             write a snapshot and the program's state to a file, as JSON if FILE ends in .json
+  :import FILE             restore an exported snapshot, clearing the input history
+  :peek ADDR [N]           show N memory cells
+  :poke ADDR VALUE...      store values in consecutive memory cells
+  :trace [on|off]          toggle tracing of executed instructions
+  :history [FILE]          show the lines input so far, or write them to a file
+  :replay FILE             run each line of a file as if it had been typed
+  :continue                resume a program stopped by an interrupt or the instruction limit
+  :quit                    leave the REPL
+Start a line with "::" to input a line starting with ':'.`
+
+// Run starts the program, then reads lines from in until it is exhausted or a quit command is
+// given
+//
+// A value received from interrupts, e.g. as relayed by signal.Notify, stops the running program
+// rather than the REPL. Interrupts received while the program is not running are ignored.
+func (r *REPL) Run(in io.Reader, interrupts <-chan os.Signal) error {
+	r.interrupts = interrupts
+	r.resume()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		quit, err := r.runLine(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// runLine inputs a line to the program or runs a meta-command
+func (r *REPL) runLine(line string) (bool, error) {
+	if strings.HasPrefix(line, ":") && !strings.HasPrefix(line, "::") {
+		return r.runCommand(line[1:])
+	}
+	if strings.HasPrefix(line, "::") {
+		line = line[1:]
+	}
+	if r.stopped != StopNeedInput {
+		return false, fmt.Errorf("Program is not waiting for input (%v)", r.stopped)
+	}
+	r.history = append(r.history, line)
+	for _, char := range []byte(line + "\n") {
+		r.machine.QueueInput(int(char))
+	}
+	r.resume()
+	return false, nil
+}
+
+// resume runs the machine until it needs more input, stops or is interrupted
+func (r *REPL) resume() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for stale := true; stale; {
+		select {
+		case <-r.interrupts:
+		default:
+			stale = false
+		}
+	}
+	go func() {
+		select {
+		case <-r.interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	reason, err := r.machine.RunLimited(ctx, r.MaxInstructions, false)
+	r.stopped = reason
+	switch {
+	case reason == StopCancelled:
+		fmt.Fprintf(r.out, "Interrupted after %d instructions (try :continue)\n", r.machine.InstructionCount())
+	case reason == StopBudget:
+		fmt.Fprintf(r.out, "Stopped after %d instructions: %v (try :continue)\n", r.machine.InstructionCount(), reason)
+	case err != nil:
+		fmt.Fprintf(r.out, "Stopped after %d instructions: %v\n", r.machine.InstructionCount(), err)
+	case reason == StopHalted:
+		fmt.Fprintf(r.out, "Halted after %d instructions\n", r.machine.InstructionCount())
+	}
+}
+
+func (r *REPL) runCommand(command string) (bool, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false, fmt.Errorf("Missing command (try :help)")
+	}
+	args := fields[1:]
+
+	switch fields[0] {
+	case "save":
+		if len(args) != 1 {
+			return false, fmt.Errorf("Usage: :save NAME")
+		}
+		r.snapshots[args[0]] = replSnapshot{
+			snapshot: r.machine.Snapshot(),
+			history:  r.History(),
+			stopped:  r.stopped,
+		}
+	case "restore":
+		if len(args) != 1 {
+			return false, fmt.Errorf("Usage: :restore NAME")
+		}
+		saved, found := r.snapshots[args[0]]
+		if !found {
+			return false, fmt.Errorf("No snapshot named %q", args[0])
+		}
+		if err := r.machine.RestoreSnapshot(saved.snapshot); err != nil {
+			return false, err
+		}
+		r.history = append([]string{}, saved.history...)
+		r.stopped = saved.stopped
+		fmt.Fprintf(r.out, "Restored %s at instruction %d\n", args[0], r.machine.InstructionCount())
+	case "snapshots":
+		names := []string{}
+		for name := range r.snapshots {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(r.out, "%s\t%d instructions, %d lines input\n", name, r.snapshots[name].snapshot.InstructionCount, len(r.snapshots[name].history))
+		}
+	case "export":
+		if len(args) != 1 {
+			return false, fmt.Errorf("Usage: :export FILE")
+		}
+		format := SnapshotBinary
+		if strings.HasSuffix(args[0], ".json") {
+			format = SnapshotJSON
+		}
+		return false, r.export(args[0], format)
+	case "import":
+		if len(args) != 1 {
+			return false, fmt.Errorf("Usage: :import FILE")
+		}
+		return false, r.importSnapshot(args[0])
+	case "peek":
+		if len(args) < 1 || len(args) > 2 {
+			return false, fmt.Errorf("Usage: :peek ADDR [N]")
+		}
+		addr, err := parseDebugAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		count := 1
+		if len(args) == 2 {
+			if count, err = strconv.Atoi(args[1]); err != nil {
+				return false, fmt.Errorf("Bad count %q", args[1])
+			}
+		}
+		for i := 0; i < count; i++ {
+			fmt.Fprintf(r.out, "%v:\t%d\n", address(addr+i), r.machine.readAddress(address(addr+i)))
+		}
+	case "poke":
+		if len(args) < 2 {
+			return false, fmt.Errorf("Usage: :poke ADDR VALUE...")
+		}
+		addr, err := parseDebugAddress(args[0])
+		if err != nil {
+			return false, err
+		}
+		values := make([]int, len(args)-1)
+		for i, arg := range args[1:] {
+			if values[i], err = strconv.Atoi(arg); err != nil {
+				return false, fmt.Errorf("Bad value %q", arg)
+			}
+		}
+		for i, value := range values {
+			r.machine.WriteRAM(address(addr+i), value)
+		}
+	case "trace":
+		if len(args) > 1 {
+			return false, fmt.Errorf("Usage: :trace [on|off]")
+		}
+		enable := r.tracer == nil
+		if len(args) == 1 {
+			switch args[0] {
+			case "on":
+				enable = true
+			case "off":
+				enable = false
+			default:
+				return false, fmt.Errorf("Usage: :trace [on|off]")
+			}
+		}
+		if enable && r.tracer == nil {
+			r.tracer = &tracer{machine: &r.machine, sinks: []TraceSink{NewTextTraceSink(r.out)}}
+			r.machine.addHook(r.tracer)
+		}
+		if !enable && r.tracer != nil {
+			r.machine.removeHook(r.tracer)
+			r.tracer = nil
+		}
+	case "history":
+		if len(args) > 1 {
+			return false, fmt.Errorf("Usage: :history [FILE]")
+		}
+		if len(args) == 0 {
+			for _, line := range r.history {
+				fmt.Fprintln(r.out, line)
+			}
+			return false, nil
+		}
+		return false, r.writeHistory(args[0])
+	case "replay":
+		if len(args) != 1 {
+			return false, fmt.Errorf("Usage: :replay FILE")
+		}
+		return r.replay(args[0])
+	case "continue":
+		if len(args) != 0 {
+			return false, fmt.Errorf("Usage: :continue")
+		}
+		if r.stopped != StopCancelled && r.stopped != StopBudget {
+			return false, fmt.Errorf("Program is not paused (%v)", r.stopped)
+		}
+		r.resume()
+	case "help":
+		fmt.Fprintln(r.out, replHelp)
+	case "quit":
+		return true, nil
+	default:
+		return false, fmt.Errorf("Unknown command %q (try :help)", fields[0])
+	}
+	return false, nil
+}
+
+// replExportMagic starts a file written by :export in binary, followed by the stop reason and then
+// the binary snapshot
+const replExportMagic = "ICRS"
+
+// replExport is a file written by :export in JSON, recording why the program stopped, which
+// snapshots do not
+type replExport struct {
+	Stopped  StopReason `json:"stopped"`
+	Snapshot *Snapshot  `json:"snapshot"`
+}
+
+func (r *REPL) export(path string, format SnapshotFormat) error {
+	buffer := &bytes.Buffer{}
+	switch format {
+	case SnapshotJSON:
+		enc := json.NewEncoder(buffer)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(replExport{r.stopped, r.machine.Snapshot()}); err != nil {
+			return fmt.Errorf("Cannot save machine: %v", err)
+		}
+	default:
+		buffer.WriteString(replExportMagic)
+		buffer.WriteByte(byte(r.stopped))
+		if err := r.machine.Snapshot().Encode(buffer, format); err != nil {
+			return err
+		}
+	}
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Cannot save machine: %v", err)
+	}
+	return nil
+}
+
+// importSnapshot restores a file written by :export
+//
+// A plain snapshot, which does not record why the program stopped, is resumed as a machine passed
+// to NewREPL would be.
+func (r *REPL) importSnapshot(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Cannot restore machine: %v", err)
+	}
+	exported := replExport{}
+	plain := false
+	switch {
+	case bytes.HasPrefix(data, []byte(replExportMagic)) && len(data) > len(replExportMagic):
+		exported.Stopped = StopReason(data[len(replExportMagic)])
+		exported.Snapshot, err = DecodeSnapshot(bytes.NewReader(data[len(replExportMagic)+1:]))
+	case json.Unmarshal(data, &exported) == nil && exported.Snapshot != nil:
+		err = exported.Snapshot.check()
+	default:
+		plain = true
+		exported.Snapshot, err = DecodeSnapshot(bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+	if exported.Stopped < StopHalted || exported.Stopped > StopNeedInput {
+		return fmt.Errorf("Cannot restore machine: unknown stop reason %d", exported.Stopped)
+	}
+	if err := r.machine.RestoreSnapshot(exported.Snapshot); err != nil {
+		return err
+	}
+	r.history = nil
+	r.stopped = exported.Stopped
+	fmt.Fprintf(r.out, "Restored %s at instruction %d\n", path, r.machine.InstructionCount())
+	if plain {
+		r.resume()
+	}
+	return nil
+}
+
+func (r *REPL) writeHistory(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Cannot write history: %v", err)
+	}
+	for _, line := range r.history {
+		if strings.HasPrefix(line, ":") {
+			line = ":" + line
+		}
+		fmt.Fprintln(f, line)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Cannot write history: %v", err)
+	}
+	return nil
+}
+
+// replay runs each line of a file, echoing lines input to the program
+//
+// Replay stops at the first line which fails.
+func (r *REPL) replay(path string) (bool, error) {
+	if r.replaying[path] {
+		return false, fmt.Errorf("Already replaying %s", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("Cannot replay: %v", err)
+	}
+	defer f.Close()
+	r.replaying[path] = true
+	defer delete(r.replaying, path)
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, ":") || strings.HasPrefix(line, "::") {
+			fmt.Fprintln(r.out, line)
+		}
+		quit, err := r.runLine(line)
+		if err != nil {
+			return false, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+		}
+		if quit {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
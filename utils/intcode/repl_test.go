@@ -0,0 +1,251 @@
+package intcode
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// replTestSource echoes its input after a '>' prompt on each line, and on reading 'q' outputs
+// 1000 plus the number of characters echoed
+const replTestSource = `
+	start:  OUT  62
+	loop:   INP  [c]
+	        CEQ  [c], 113, [t]
+	        JNZ  [t], done
+	        OUT  [c]
+	        ADD  [count], 1, [count]
+	        CEQ  [c], 10, [t]
+	        JNZ  [t], start
+	        JNZ  1, loop
+	done:   ADD  [count], 1000, [count]
+	        OUT  [count]
+	        HCF
+	c:      DATA 0
+	t:      DATA 0
+	count:  DATA 0
+`
+
+func newREPLTestMachine(t *testing.T) *Machine {
+	program, err := Assemble(replTestSource)
+	assert.NoError(t, err)
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram(program))
+	return &m
+}
+
+func TestREPL(t *testing.T) {
+	out := &bytes.Buffer{}
+	r, err := NewREPL(newREPLTestMachine(t), out)
+	assert.NoError(t, err)
+
+	commands := strings.Join([]string{
+		"hi",
+		":save a",
+		"there",
+		":peek 0 2",
+		":restore a",
+		":history",
+		":poke 1 35",
+		"::x",
+		":snapshots",
+		"q",
+		"more",
+		":bogus",
+		":quit",
+		"ignored",
+	}, "\n")
+	assert.NoError(t, r.Run(strings.NewReader(commands), nil))
+
+	expected := strings.Join([]string{
+		">hi",
+		">there",
+		">#0000:\t104",
+		"#0001:\t62",
+		"Restored a at instruction 25",
+		"hi",
+		":x",
+		"#a\t25 instructions, 1 lines input",
+		"1006",
+		"Halted after 55 instructions",
+		"Error: Program is not waiting for input (halted)",
+		"Error: Unknown command \"bogus\" (try :help)",
+		"",
+	}, "\n")
+	assert.Equal(t, expected, out.String())
+	assert.Equal(t, []string{"hi", ":x", "q"}, r.History())
+	assert.Equal(t, 1006, r.Machine().Register(M19RegisterOutput))
+
+	_, err = NewREPL(&Machine{&machineState{}}, out)
+	assert.Error(t, err)
+}
+
+func TestREPLTrace(t *testing.T) {
+	out := &bytes.Buffer{}
+	r, err := NewREPL(newREPLTestMachine(t), out)
+	assert.NoError(t, err)
+	r.resume()
+
+	quit, err := r.runLine(":trace")
+	assert.False(t, quit)
+	assert.NoError(t, err)
+	out.Reset()
+	_, err = r.runLine("")
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "INP")
+	assert.Contains(t, out.String(), "OUT")
+
+	_, err = r.runLine(":trace off")
+	assert.NoError(t, err)
+	out.Reset()
+	_, err = r.runLine("")
+	assert.NoError(t, err)
+	assert.Equal(t, "\n>", out.String())
+
+	_, err = r.runLine(":trace maybe")
+	assert.EqualError(t, err, "Usage: :trace [on|off]")
+}
+
+func TestREPLFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "intcode")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	historyPath := filepath.Join(dir, "history")
+	snapshotPath := filepath.Join(dir, "state.json")
+
+	out := &bytes.Buffer{}
+	r, err := NewREPL(newREPLTestMachine(t), out)
+	assert.NoError(t, err)
+	commands := strings.Join([]string{
+		"ab",
+		"::c",
+		":history " + historyPath,
+		":export " + snapshotPath,
+		"d",
+	}, "\n")
+	assert.NoError(t, r.Run(strings.NewReader(commands), nil))
+	history, err := ioutil.ReadFile(historyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "ab\n::c\n", string(history))
+
+	out = &bytes.Buffer{}
+	r, err = NewREPL(newREPLTestMachine(t), out)
+	assert.NoError(t, err)
+	r.resume()
+	_, err = r.runLine(":replay " + historyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, ">ab\nab\n>::c\n:c\n>", out.String())
+	assert.Equal(t, []string{"ab", ":c"}, r.History())
+
+	_, err = r.runLine(":import " + snapshotPath)
+	assert.NoError(t, err)
+	assert.Empty(t, r.History())
+	_, err = r.runLine("q")
+	assert.NoError(t, err)
+	assert.Equal(t, 1006, r.Machine().Register(M19RegisterOutput))
+
+	ioutil.WriteFile(historyPath, []byte("x\n:replay "+historyPath+"\n"), 0644)
+	_, err = r.runLine(":replay " + historyPath)
+	assert.EqualError(t, err, historyPath+":1: Program is not waiting for input (halted)")
+	_, err = r.runLine(":restore missing")
+	assert.EqualError(t, err, `No snapshot named "missing"`)
+
+	haltedPath := filepath.Join(dir, "halted")
+	_, err = r.runLine(":export " + haltedPath)
+	assert.NoError(t, err)
+	r, err = NewREPL(newREPLTestMachine(t), out)
+	assert.NoError(t, err)
+	r.resume()
+	_, err = r.runLine(":import " + haltedPath)
+	assert.NoError(t, err)
+	_, err = r.runLine("x")
+	assert.EqualError(t, err, "Program is not waiting for input (halted)")
+
+	plainPath := filepath.Join(dir, "plain")
+	assert.NoError(t, newREPLTestMachine(t).SaveSnapshot(plainPath, SnapshotBinary))
+	out.Reset()
+	_, err = r.runLine(":import " + plainPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "Restored "+plainPath+" at instruction 0\n>", out.String())
+	assert.Equal(t, StopNeedInput, r.stopped)
+
+	ioutil.WriteFile(plainPath, []byte(`{"stopped": 9, "snapshot": {"version": 2, "model": "M19"}}`), 0644)
+	_, err = r.runLine(":import " + plainPath)
+	assert.EqualError(t, err, "Cannot restore machine: unknown stop reason 9")
+}
+
+// interruptingWriter raises an interrupt whenever it is written to
+type interruptingWriter struct {
+	bytes.Buffer
+	interrupts chan os.Signal
+}
+
+func (w *interruptingWriter) Write(p []byte) (int, error) {
+	select {
+	case w.interrupts <- os.Interrupt:
+	default:
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestREPLInterrupt(t *testing.T) {
+	program, err := Assemble("loop: JNZ 1, loop")
+	assert.NoError(t, err)
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram(program))
+
+	out := &bytes.Buffer{}
+	r, err := NewREPL(&m, out)
+	assert.NoError(t, err)
+	r.MaxInstructions = 10
+	assert.NoError(t, r.Run(strings.NewReader(":continue\nx\n:quit\n"), nil))
+	assert.Equal(t, strings.Join([]string{
+		"Stopped after 10 instructions: budget exhausted (try :continue)",
+		"Stopped after 20 instructions: budget exhausted (try :continue)",
+		"Error: Program is not waiting for input (budget exhausted)",
+		"",
+	}, "\n"), out.String())
+
+	program, err = Assemble("loop: OUT 46\nJNZ 1, loop")
+	assert.NoError(t, err)
+	m = NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram(program))
+	interrupts := make(chan os.Signal, 1)
+	interrupts <- os.Interrupt
+	writer := &interruptingWriter{interrupts: interrupts}
+	r, err = NewREPL(&m, writer)
+	assert.NoError(t, err)
+	r.MaxInstructions = 100000
+	assert.NoError(t, r.Run(strings.NewReader(""), interrupts))
+	assert.Equal(t, StopCancelled, r.stopped)
+	assert.Regexp(t, `^\.+Interrupted after \d+ instructions \(try :continue\)\n$`, writer.String())
+	_, err = r.runLine(":restore missing")
+	assert.Error(t, err)
+
+	dir, err := ioutil.TempDir("", "intcode")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	exportPath := filepath.Join(dir, "interrupted")
+	_, err = r.runLine(":export " + exportPath)
+	assert.NoError(t, err)
+	count := r.Machine().InstructionCount()
+	out.Reset()
+	imported, err := NewREPL(&m, out)
+	assert.NoError(t, err)
+	imported.MaxInstructions = 10
+	_, err = imported.runLine(":import " + exportPath)
+	assert.NoError(t, err)
+	assert.Equal(t, StopCancelled, imported.stopped)
+	_, err = imported.runLine(":continue")
+	assert.NoError(t, err)
+	assert.Equal(t, count+10, imported.Machine().InstructionCount())
+
+	r.stopped = StopHalted
+	_, err = r.runLine(":continue")
+	assert.EqualError(t, err, "Program is not paused (halted)")
+}
@@ -0,0 +1,93 @@
+package intcode
+
+import (
+	"context"
+	"fmt"
+)
+
+// StopReason describes why a bounded run stopped
+type StopReason int
+
+const (
+	// StopHalted indicates the program halted
+	StopHalted StopReason = iota
+	// StopInterrupt indicates an interrupt was raised, e.g. by an output
+	StopInterrupt
+	// StopBudget indicates the instruction budget was used up
+	StopBudget
+	// StopCancelled indicates the context was cancelled or timed out
+	StopCancelled
+	// StopInvalidInstruction indicates an instruction could not be executed
+	StopInvalidInstruction
+	// StopNeedInput indicates the program is waiting for input to be queued
+	StopNeedInput
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopHalted:
+		return "halted"
+	case StopInterrupt:
+		return "interrupt"
+	case StopBudget:
+		return "budget exhausted"
+	case StopCancelled:
+		return "cancelled"
+	case StopInvalidInstruction:
+		return "invalid instruction"
+	case StopNeedInput:
+		return "waiting for input"
+	}
+	return fmt.Sprintf("StopReason(%d)", int(r))
+}
+
+// contextCheckInterval is the number of instructions executed between checks for cancellation
+const contextCheckInterval = 1024
+
+// InstructionCount returns the number of instructions the machine has executed
+func (m *Machine) InstructionCount() int {
+	return m.instructionCount
+}
+
+// RunContext runs the processor until it halts or ctx is done
+func (m *Machine) RunContext(ctx context.Context, stopOnInterrupt bool) (StopReason, error) {
+	return m.RunLimited(ctx, 0, stopOnInterrupt)
+}
+
+// RunFor runs the processor until it halts or maxInstructions instructions have executed
+func (m *Machine) RunFor(maxInstructions int, stopOnInterrupt bool) (StopReason, error) {
+	return m.RunLimited(context.Background(), maxInstructions, stopOnInterrupt)
+}
+
+// RunLimited runs the processor until it halts, ctx is done or maxInstructions instructions have
+// executed
+//
+// A maxInstructions of 0 or less places no limit on execution. The error is that of the context
+// if cancelled, or the *ExecError for an invalid instruction.
+func (m *Machine) RunLimited(ctx context.Context, maxInstructions int, stopOnInterrupt bool) (StopReason, error) {
+	done := ctx.Done()
+	for executed := 0; maxInstructions <= 0 || executed < maxInstructions; executed++ {
+		if done != nil && executed%contextCheckInterval == 0 {
+			select {
+			case <-done:
+				return StopCancelled, ctx.Err()
+			default:
+			}
+		}
+		rc, err := m.TryStep()
+		switch rc {
+		case ExecRCNone:
+		case ExecRCInterrupt:
+			if stopOnInterrupt {
+				return StopInterrupt, nil
+			}
+		case ExecRCInvalidInstruction:
+			return StopInvalidInstruction, err
+		case ExecRCNeedInput:
+			return StopNeedInput, nil
+		default:
+			return StopHalted, nil
+		}
+	}
+	return StopBudget, nil
+}
@@ -0,0 +1,65 @@
+package intcode
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLimited(t *testing.T) {
+	type testDef struct {
+		program         string
+		maxInstructions int
+		stopOnInterrupt bool
+		reason          StopReason
+		count           int
+	}
+	tests := []testDef{
+		{"1105,1,0", 100, false, StopBudget, 100},
+		{"1101,1,1,0,99", 100, false, StopHalted, 2},
+		{"104,1,104,2,99", 100, true, StopInterrupt, 1},
+		{"104,1,104,2,99", 100, false, StopHalted, 3},
+		{"104,1,104,2,99", 2, false, StopBudget, 2},
+		{"1101,1,1,0,42", 0, false, StopInvalidInstruction, 1},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			m := NewMachine(M19(nil, nil))
+			assert.NoError(t, m.LoadProgram(test.program))
+			reason, err := m.RunFor(test.maxInstructions, test.stopOnInterrupt)
+			assert.Equal(t, test.reason, reason)
+			assert.Equal(t, test.count, m.InstructionCount())
+			if reason == StopInvalidInstruction {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1105,1,0"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reason, err := m.RunContext(ctx, false)
+	assert.Equal(t, StopCancelled, reason)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, m.InstructionCount())
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	reason, err = m.RunContext(ctx, false)
+	assert.Equal(t, StopCancelled, reason)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, m.InstructionCount() > 0)
+
+	reason, err = m.RunLimited(context.Background(), 10, false)
+	assert.Equal(t, StopBudget, reason)
+	assert.NoError(t, err)
+}
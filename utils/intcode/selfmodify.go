@@ -0,0 +1,104 @@
+package intcode
+
+import "fmt"
+
+// SelfModifyMode selects how the machine treats instructions which write to code it has already
+// executed
+type SelfModifyMode int
+
+const (
+	// SelfModifyAllow permits writes to code without tracking executed addresses
+	SelfModifyAllow SelfModifyMode = iota
+	// SelfModifyReport records writes to previously executed code, available from CodeWrites
+	SelfModifyReport
+	// SelfModifyError fails instructions which would write to previously executed code with
+	// ErrSelfModify
+	SelfModifyError
+)
+
+func (s SelfModifyMode) String() string {
+	switch s {
+	case SelfModifyAllow:
+		return "allow"
+	case SelfModifyReport:
+		return "report"
+	case SelfModifyError:
+		return "error"
+	}
+	return fmt.Sprintf("SelfModifyMode(%d)", int(s))
+}
+
+// SelfModify sets how the machine treats writes to code it has already executed
+//
+// Every address making up an executed instruction, including its parameters, counts as code.
+// With SelfModifyError, only the parameter an opcode declares as its WriteParam is checked before
+// the instruction runs; other writes made by custom opcodes are still recorded.
+func SelfModify(mode SelfModifyMode) MachineOption {
+	return func(m *Machine) {
+		m.selfModify = mode
+	}
+}
+
+// CodeWrite describes an instruction writing to previously executed code
+type CodeWrite struct {
+	// Address is the location written
+	Address int
+	// Instruction is the address of the executed instruction which Address is part of
+	Instruction int
+	// Writer is the address of the instruction making the write
+	Writer int
+	// InstructionCount is the number of the writing instruction (counting from 1)
+	InstructionCount int
+	Previous, Value  int
+}
+
+func (w CodeWrite) String() string {
+	return fmt.Sprintf("%v (in %v) written by %v: %d -> %d (instruction %d)",
+		address(w.Address), address(w.Instruction), address(w.Writer), w.Previous, w.Value, w.InstructionCount,
+	)
+}
+
+// CodeWrites returns the writes to previously executed code made since the machine was created or
+// last restored, oldest first
+func (m *Machine) CodeWrites() []CodeWrite {
+	return append([]CodeWrite{}, m.codeWrites...)
+}
+
+// markExecuted records the addresses making up an instruction which has completed
+func (m *Machine) markExecuted(ip address, op operation) {
+	if m.executed == nil {
+		m.executed = map[address]address{}
+	}
+	for offset := 0; offset <= op.NumParams(); offset++ {
+		m.executed[ip+address(offset)] = ip
+	}
+}
+
+// checkCodeWrite records a write to previously executed code by the current instruction
+func (m *Machine) checkCodeWrite(addr address, previous, value int) {
+	instruction, found := m.executed[addr]
+	if !found || m.history.replaying(m.instructionCount) {
+		return
+	}
+	m.codeWrites = append(m.codeWrites, CodeWrite{
+		Address:          int(addr),
+		Instruction:      int(instruction),
+		Writer:           int(m.stepAddress),
+		InstructionCount: m.instructionCount,
+		Previous:         previous,
+		Value:            value,
+	})
+}
+
+// checkSelfModify fails an instruction whose write parameter refers to previously executed code
+func (in *Instruction) checkSelfModify() error {
+	machine := in.binding.machine
+	param := in.opcode.WriteParam
+	if machine.selfModify != SelfModifyError || param < 0 {
+		return nil
+	}
+	if _, found := machine.executed[in.params[param]]; found {
+		return in.execError(ErrSelfModify, param+1)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package intcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// selfModifyTestProgram outputs 7, then overwrites the OUT instruction with HCF and jumps back to it
+const selfModifyTestProgram = "104,7,1101,0,99,0,1105,1,0"
+
+func TestSelfModify(t *testing.T) {
+	patch := CodeWrite{Address: 0, Instruction: 0, Writer: 2, InstructionCount: 2, Previous: 104, Value: 99}
+	type testDef struct {
+		mode    SelfModifyMode
+		rc      ExecReturnCode
+		err     string
+		writes  []CodeWrite
+		count   int
+		finalIP int
+	}
+	tests := []testDef{
+		{mode: SelfModifyAllow, rc: ExecRCHCF, writes: []CodeWrite{}, count: 4},
+		{mode: SelfModifyReport, rc: ExecRCHCF, writes: []CodeWrite{patch}, count: 4},
+		{
+			mode:    SelfModifyError,
+			rc:      ExecRCInvalidInstruction,
+			err:     "Write to executed code at #0002 (opcode 1101, parameter 3, mode 0, instruction 2)",
+			writes:  []CodeWrite{},
+			count:   1,
+			finalIP: 2,
+		},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			outputs := []int{}
+			m := NewMachine(M19(nil, func(value int) { outputs = append(outputs, value) }), SelfModify(test.mode))
+			assert.NoError(t, m.LoadProgram(selfModifyTestProgram))
+			rc, err := m.TryRun(false)
+			assert.Equal(t, test.rc, rc)
+			if test.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.err)
+				assert.True(t, errors.Is(err, ErrSelfModify))
+				assert.Equal(t, 104, m.ReadRAM(0))
+			}
+			assert.Equal(t, []int{7}, outputs)
+			assert.Equal(t, test.writes, m.CodeWrites())
+			assert.Equal(t, test.count, m.instructionCount)
+			if test.finalIP > 0 {
+				assert.Equal(t, test.finalIP, m.Register(RegisterInstructionPointer))
+			}
+		})
+	}
+}
+
+func TestSelfModifyHistory(t *testing.T) {
+	m := NewMachine(M19(nil, nil), SelfModify(SelfModifyReport), History(10, 2, 4))
+	assert.NoError(t, m.LoadProgram(selfModifyTestProgram))
+	m.Run(false)
+	assert.Len(t, m.CodeWrites(), 1)
+
+	assert.NoError(t, m.RewindTo(1))
+	assert.Equal(t, 104, m.ReadRAM(0))
+	m.Run(false)
+	assert.Equal(t, 99, m.ReadRAM(0))
+	assert.Len(t, m.CodeWrites(), 1)
+
+	c := m.Clone()
+	assert.Len(t, c.CodeWrites(), 1)
+	assert.NoError(t, m.RestoreSnapshot(m.Snapshot()))
+	assert.Empty(t, m.CodeWrites())
+}
+
+func TestDecodeConsistency(t *testing.T) {
+	// Jumps into the middle of the instruction at 3, which is decoded up front by DecodeOps
+	program := "1105,1,4,1101,104,5,99,0"
+	for id, options := range [][]MachineOption{{}, {DenseMemory()}} {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			outputs := []int{}
+			options = append(options, M19(nil, func(value int) { outputs = append(outputs, value) }), DecodeOps())
+			m := NewMachine(options...)
+			assert.NoError(t, m.LoadProgram(program))
+			m.Run(false)
+			assert.Equal(t, []int{5}, outputs)
+			assert.Contains(t, m.String(), "\t#0003:\tOPER\tADD\t'104'\t'5'\t#99 (0)\n\t#0007:\tDATA\t0")
+
+			m.WriteRAM(3, 1)
+			assert.Contains(t, m.String(), "\t#0003:\tDATA\t1\t(1)\n\t#0004:\tOPER\tOUT\t'5'\n")
+
+			assert.NoError(t, m.RestoreSnapshot(m.Snapshot()))
+			m.WriteRAM(4, 4)
+			assert.Contains(t, m.String(), "\t#0003:\tOPER\tADD\t#4 (4)\t#5 (5)\t#99 (0)\n")
+			m.WriteRAM(3, 99)
+			assert.Contains(t, m.String(), "\t#0003:\tDATA\t99\t(63)\n\t#0004:\tDATA\t4\t(4)\n")
+		})
+	}
+}
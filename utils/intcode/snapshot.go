@@ -0,0 +1,440 @@
+package intcode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+)
+
+// SnapshotVersion is the version of the snapshot format written by this package
+const SnapshotVersion = 2
+
+// snapshotMagic identifies the binary snapshot encoding
+const snapshotMagic = "ICSN"
+
+// maxSnapshotString limits the length of strings read from binary snapshots
+const maxSnapshotString = 256
+
+// maxSnapshotNumber limits the length of promoted values read from binary snapshots
+const maxSnapshotNumber = 1 << 20
+
+// SnapshotFormat selects how a snapshot is encoded
+type SnapshotFormat int
+
+const (
+	// SnapshotBinary is a compact varint encoding
+	SnapshotBinary SnapshotFormat = iota
+	// SnapshotJSON is an indented, human readable encoding
+	SnapshotJSON
+)
+
+// Snapshot is a serialisable copy of the state of a machine
+//
+// Input and output callbacks, hooks and history are not included.
+type Snapshot struct {
+	Version          int         `json:"version"`
+	Model            string      `json:"model"`
+	InstructionCount int         `json:"instructionCount"`
+	Registers        map[int]int `json:"registers"`
+	// RAM holds runs of consecutive values which have been set, in address order
+	RAM        []MemoryRange  `json:"ram"`
+	InputQueue []int          `json:"inputQueue,omitempty"`
+	ModelData  map[string]int `json:"modelData,omitempty"`
+	// Overflow and BigRAM were added in version 2
+	Overflow OverflowMode `json:"overflow,omitempty"`
+	// BigRAM holds the exact decimal values of promoted cells, whose wrapped values are in RAM
+	BigRAM map[int]string `json:"bigRAM,omitempty"`
+}
+
+// MemoryRange is a run of values stored at consecutive addresses
+type MemoryRange struct {
+	Start  int   `json:"start"`
+	Values []int `json:"values"`
+}
+
+// Snapshot captures the current state of the machine
+func (m *Machine) Snapshot() *Snapshot {
+	s := &Snapshot{
+		Version:          SnapshotVersion,
+		Model:            m.model.name(),
+		InstructionCount: m.instructionCount,
+		Registers:        map[int]int{},
+		RAM:              []MemoryRange{},
+		ModelData:        m.model.saveState(),
+		Overflow:         m.overflow,
+	}
+	for reg, value := range m.registers {
+		s.Registers[int(reg)] = value
+	}
+	if len(m.inputQueue) > 0 {
+		s.InputQueue = append([]int{}, m.inputQueue...)
+	}
+	for _, addr := range m.ram.addresses() {
+		value := m.readAddress(addr)
+		last := len(s.RAM) - 1
+		if last >= 0 && s.RAM[last].Start+len(s.RAM[last].Values) == int(addr) {
+			s.RAM[last].Values = append(s.RAM[last].Values, value)
+			continue
+		}
+		s.RAM = append(s.RAM, MemoryRange{Start: int(addr), Values: []int{value}})
+	}
+	if len(m.bigValues) > 0 {
+		s.BigRAM = map[int]string{}
+		for addr, value := range m.bigValues {
+			s.BigRAM[int(addr)] = value.String()
+		}
+	}
+	return s
+}
+
+// RestoreSnapshot replaces the state of the machine with that held in a snapshot
+//
+// The machine is left unchanged if the snapshot is from a different model, overflow mode or format
+// version. Otherwise, which code has been executed and any writes to it recorded by SelfModify are
+// forgotten, as is any History.
+func (m *Machine) RestoreSnapshot(s *Snapshot) error {
+	if s.Overflow != m.overflow {
+		return fmt.Errorf("Cannot restore machine: snapshot has overflow mode %v, not %v", s.Overflow, m.overflow)
+	}
+	if err := m.restoreSnapshot(s); err != nil {
+		return err
+	}
+	m.history.reset()
+	return nil
+}
+
+// restoreSnapshot replaces the state of the machine, leaving any history intact
+func (m *Machine) restoreSnapshot(s *Snapshot) error {
+	bigValues, err := s.bigValues()
+	if err != nil {
+		return err
+	}
+	if s.Model != m.model.name() {
+		return fmt.Errorf("Cannot restore machine: snapshot is from an %s machine, not %s", s.Model, m.model.name())
+	}
+
+	m.ram.wipe()
+	for addr := range m.operations {
+		delete(m.operations, addr)
+	}
+	for reg := range m.registers {
+		delete(m.registers, reg)
+	}
+	for reg, value := range s.Registers {
+		m.setRegister(registerID(reg), value)
+	}
+	for _, run := range s.RAM {
+		for offset, value := range run.Values {
+			m.ram.write(address(run.Start+offset), value)
+		}
+	}
+	m.bigValues = nil
+	for addr, value := range bigValues {
+		m.ram.write(addr, wrapBig(value))
+		m.setBig(addr, value)
+	}
+	m.inputQueue = append([]int{}, s.InputQueue...)
+	m.instructionCount = s.InstructionCount
+	m.executed = nil
+	m.codeWrites = nil
+	m.model.restoreState(s.ModelData)
+	return nil
+}
+
+// check validates the parts of a snapshot that do not depend on the machine
+func (s *Snapshot) check() error {
+	_, err := s.bigValues()
+	return err
+}
+
+// checkHeader validates the version and RAM addresses of a snapshot
+func (s *Snapshot) checkHeader() error {
+	if s.Version < 1 || s.Version > SnapshotVersion {
+		return fmt.Errorf("Cannot restore machine: unsupported snapshot version %d", s.Version)
+	}
+	for _, run := range s.RAM {
+		if run.Start < 0 {
+			return fmt.Errorf("Cannot restore machine: %w", ErrNegativeAddress)
+		}
+	}
+	return nil
+}
+
+// bigValues parses the promoted values held by the snapshot
+func (s *Snapshot) bigValues() (map[address]*big.Int, error) {
+	if err := s.checkHeader(); err != nil {
+		return nil, err
+	}
+	values := map[address]*big.Int{}
+	for addr, text := range s.BigRAM {
+		value, ok := new(big.Int).SetString(text, 10)
+		switch {
+		case addr < 0:
+			return nil, fmt.Errorf("Cannot restore machine: %w", ErrNegativeAddress)
+		case !ok:
+			return nil, fmt.Errorf("Cannot restore machine: invalid value %q at %v", text, address(addr))
+		}
+		values[address(addr)] = value
+	}
+	return values, nil
+}
+
+// Encode writes the snapshot to w in the requested format
+func (s *Snapshot) Encode(w io.Writer, format SnapshotFormat) error {
+	switch format {
+	case SnapshotJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(s); err != nil {
+			return fmt.Errorf("Cannot save machine: %v", err)
+		}
+		return nil
+	case SnapshotBinary:
+		bw := bufio.NewWriter(w)
+		s.encodeBinary(bw)
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("Cannot save machine: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("Cannot save machine: unknown snapshot format %d", format)
+}
+
+// DecodeSnapshot reads a snapshot in either format from r
+func DecodeSnapshot(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(snapshotMagic))
+	if err != nil && len(head) == 0 {
+		return nil, fmt.Errorf("Cannot restore machine: %v", err)
+	}
+	s := &Snapshot{}
+	if string(head) == snapshotMagic {
+		br.Discard(len(snapshotMagic))
+		err = s.decodeBinary(br)
+	} else {
+		err = json.NewDecoder(br).Decode(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Cannot restore machine: %v", err)
+	}
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveSnapshot writes a snapshot of the machine to a file
+func (m *Machine) SaveSnapshot(path string, format SnapshotFormat) error {
+	buffer := &bytes.Buffer{}
+	if err := m.Snapshot().Encode(buffer, format); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Cannot save machine: %v", err)
+	}
+	return nil
+}
+
+// LoadSnapshot restores the machine from a snapshot file in either format
+func (m *Machine) LoadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Cannot restore machine: %v", err)
+	}
+	defer f.Close()
+	s, err := DecodeSnapshot(f)
+	if err != nil {
+		return err
+	}
+	return m.RestoreSnapshot(s)
+}
+
+type snapshotWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (sw *snapshotWriter) uint(value int) {
+	n := binary.PutUvarint(sw.buf[:], uint64(value))
+	sw.w.Write(sw.buf[:n])
+}
+
+func (sw *snapshotWriter) int(value int) {
+	n := binary.PutVarint(sw.buf[:], int64(value))
+	sw.w.Write(sw.buf[:n])
+}
+
+func (sw *snapshotWriter) string(value string) {
+	sw.uint(len(value))
+	sw.w.WriteString(value)
+}
+
+func (s *Snapshot) encodeBinary(w *bufio.Writer) {
+	sw := &snapshotWriter{w: w}
+	w.WriteString(snapshotMagic)
+	sw.uint(s.Version)
+	sw.string(s.Model)
+	sw.int(s.InstructionCount)
+
+	regs := make([]int, 0, len(s.Registers))
+	for reg := range s.Registers {
+		regs = append(regs, reg)
+	}
+	sort.Ints(regs)
+	sw.uint(len(regs))
+	for _, reg := range regs {
+		sw.int(reg)
+		sw.int(s.Registers[reg])
+	}
+
+	sw.uint(len(s.RAM))
+	for _, run := range s.RAM {
+		sw.int(run.Start)
+		sw.uint(len(run.Values))
+		for _, value := range run.Values {
+			sw.int(value)
+		}
+	}
+
+	sw.uint(len(s.InputQueue))
+	for _, value := range s.InputQueue {
+		sw.int(value)
+	}
+
+	keys := make([]string, 0, len(s.ModelData))
+	for key := range s.ModelData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sw.uint(len(keys))
+	for _, key := range keys {
+		sw.string(key)
+		sw.int(s.ModelData[key])
+	}
+
+	sw.uint(int(s.Overflow))
+	addrs := make([]int, 0, len(s.BigRAM))
+	for addr := range s.BigRAM {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+	sw.uint(len(addrs))
+	for _, addr := range addrs {
+		sw.int(addr)
+		sw.string(s.BigRAM[addr])
+	}
+}
+
+type snapshotReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (sr *snapshotReader) uint() int {
+	if sr.err != nil {
+		return 0
+	}
+	value, err := binary.ReadUvarint(sr.r)
+	if err == nil && value > uint64(^uint(0)>>1) {
+		err = fmt.Errorf("Length %d out of range", value)
+	}
+	sr.fail(err)
+	return int(value)
+}
+
+func (sr *snapshotReader) int() int {
+	if sr.err != nil {
+		return 0
+	}
+	value, err := binary.ReadVarint(sr.r)
+	sr.fail(err)
+	return int(value)
+}
+
+func (sr *snapshotReader) string() string {
+	return sr.limitedString(maxSnapshotString)
+}
+
+func (sr *snapshotReader) limitedString(maxLength int) string {
+	length := sr.uint()
+	if sr.err != nil {
+		return ""
+	}
+	if length > maxLength {
+		sr.fail(fmt.Errorf("String length %d out of range", length))
+		return ""
+	}
+	raw := make([]byte, length)
+	_, err := io.ReadFull(sr.r, raw)
+	sr.fail(err)
+	return string(raw)
+}
+
+func (sr *snapshotReader) fail(err error) {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if sr.err == nil {
+		sr.err = err
+	}
+}
+
+// decodeBinary reads the binary encoding following the magic header
+//
+// Lengths are not trusted for allocation, so garbage data fails at the end of the input.
+func (s *Snapshot) decodeBinary(r *bufio.Reader) error {
+	sr := &snapshotReader{r: r}
+	s.Version = sr.uint()
+	if sr.err == nil && (s.Version < 1 || s.Version > SnapshotVersion) {
+		return fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	s.Model = sr.string()
+	s.InstructionCount = sr.int()
+
+	s.Registers = map[int]int{}
+	for i, count := 0, sr.uint(); i < count && sr.err == nil; i++ {
+		reg := sr.int()
+		s.Registers[reg] = sr.int()
+	}
+
+	s.RAM = []MemoryRange{}
+	for i, count := 0, sr.uint(); i < count && sr.err == nil; i++ {
+		run := MemoryRange{Start: sr.int()}
+		for j, length := 0, sr.uint(); j < length && sr.err == nil; j++ {
+			run.Values = append(run.Values, sr.int())
+		}
+		s.RAM = append(s.RAM, run)
+	}
+
+	for i, count := 0, sr.uint(); i < count && sr.err == nil; i++ {
+		s.InputQueue = append(s.InputQueue, sr.int())
+	}
+
+	for i, count := 0, sr.uint(); i < count && sr.err == nil; i++ {
+		if s.ModelData == nil {
+			s.ModelData = map[string]int{}
+		}
+		key := sr.string()
+		s.ModelData[key] = sr.int()
+	}
+	if s.Version < 2 {
+		return sr.err
+	}
+
+	s.Overflow = OverflowMode(sr.uint())
+	for i, count := 0, sr.uint(); i < count && sr.err == nil; i++ {
+		if s.BigRAM == nil {
+			s.BigRAM = map[int]string{}
+		}
+		addr := sr.int()
+		s.BigRAM[addr] = sr.limitedString(maxSnapshotNumber)
+	}
+	return sr.err
+}
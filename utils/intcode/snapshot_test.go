@@ -0,0 +1,126 @@
+package intcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	program := "109,1,204,-1,1001,100,1,100,1008,100,16,101,1006,101,0,99"
+	expected := []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}
+
+	for _, format := range []SnapshotFormat{SnapshotBinary, SnapshotJSON} {
+		t.Run(fmt.Sprintf("Format %d", format), func(t *testing.T) {
+			outputs := []int{}
+			m := NewMachine(M19(nil, func(value int) { outputs = append(outputs, value) }))
+			assert.NoError(t, m.LoadProgram(program))
+			for i := 0; i < 20; i++ {
+				m.Step()
+			}
+			m.QueueInput(7, 8)
+
+			buffer := &bytes.Buffer{}
+			assert.NoError(t, m.Snapshot().Encode(buffer, format))
+			s, err := DecodeSnapshot(buffer)
+			assert.NoError(t, err)
+			assert.Equal(t, m.Snapshot(), s)
+
+			m2 := NewMachine(M19(nil, func(value int) { outputs = append(outputs, value) }))
+			assert.NoError(t, m2.LoadProgram("99,1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18"))
+			assert.NoError(t, m2.RestoreSnapshot(s))
+			assert.Equal(t, m.registers, m2.registers)
+			assert.Equal(t, m.Memory(), m2.Memory())
+			assert.Equal(t, 20, m2.InstructionCount())
+			assert.Equal(t, []int{7, 8}, m2.inputQueue)
+
+			m2.Run(false)
+			assert.Equal(t, expected, outputs)
+		})
+	}
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,1,2,5,99,0"))
+	m.WriteRAM(100, 7)
+
+	buffer := &bytes.Buffer{}
+	assert.NoError(t, m.Snapshot().Encode(buffer, SnapshotJSON))
+	json := buffer.String()
+	assert.Contains(t, json, `"version": 2`)
+	assert.Contains(t, json, `"model": "M19"`)
+	assert.Equal(t, 2, strings.Count(json, `"start"`))
+}
+
+func TestSnapshotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "intcode")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,1,2,5,99,0"))
+	m.Step()
+
+	for id, format := range []SnapshotFormat{SnapshotBinary, SnapshotJSON} {
+		path := filepath.Join(dir, fmt.Sprintf("state%d", id))
+		assert.NoError(t, m.SaveSnapshot(path, format))
+
+		m2 := NewMachine(M19(nil, nil))
+		assert.NoError(t, m2.LoadSnapshot(path))
+		assert.Equal(t, 3, m2.ReadRAM(5))
+		assert.Equal(t, 4, m2.Register(RegisterInstructionPointer))
+	}
+	assert.Error(t, m.LoadSnapshot(filepath.Join(dir, "missing")))
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("1101,1,2,5,99,0"))
+
+	s := m.Snapshot()
+	s.Model = "M20"
+	assert.EqualError(t, m.RestoreSnapshot(s), "Cannot restore machine: snapshot is from an M20 machine, not M19")
+
+	s = m.Snapshot()
+	s.Version = SnapshotVersion + 1
+	assert.Error(t, m.RestoreSnapshot(s))
+	buffer := &bytes.Buffer{}
+	assert.NoError(t, s.Encode(buffer, SnapshotJSON))
+	_, err := DecodeSnapshot(buffer)
+	assert.EqualError(t, err, "Cannot restore machine: unsupported snapshot version 3")
+
+	s = m.Snapshot()
+	s.RAM[0].Start = -1
+	assert.True(t, errors.Is(m.RestoreSnapshot(s), ErrNegativeAddress))
+
+	buffer.Reset()
+	assert.NoError(t, m.Snapshot().Encode(buffer, SnapshotBinary))
+	raw := buffer.Bytes()
+	for length := 0; length < len(raw); length++ {
+		_, err := DecodeSnapshot(bytes.NewReader(raw[:length]))
+		assert.Error(t, err, "Truncated to %d bytes", length)
+	}
+	_, err = DecodeSnapshot(strings.NewReader("ICSN\x01\xff\xff\xff\xff\x0f"))
+	assert.Error(t, err)
+	assert.Equal(t, 1101, m.ReadRAM(0))
+}
+
+func TestSnapshotVersion1(t *testing.T) {
+	raw := "ICSN\x01\x03M19\x00\x01\x02\x00\x01\x00\x02\xc6\x01\x00\x00\x00"
+	s, err := DecodeSnapshot(strings.NewReader(raw))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.Version)
+
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.RestoreSnapshot(s))
+	assert.Equal(t, map[int]int{0: 99, 1: 0}, m.Memory())
+	assert.Equal(t, OverflowWrap, m.overflow)
+}
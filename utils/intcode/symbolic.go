@@ -0,0 +1,788 @@
+package intcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expr is a linear combination of input symbols plus a constant
+//
+// Symbol n is the nth value input, counting from 0.
+type Expr struct {
+	Const int
+	// Terms lists the symbols with non-zero coefficients, in symbol order
+	Terms []Term
+}
+
+// Term is a symbol multiplied by a coefficient
+type Term struct {
+	Symbol, Coeff int
+}
+
+// Constant creates an expression with a fixed value
+func Constant(value int) Expr {
+	return Expr{Const: value}
+}
+
+// symbol creates an expression for a single input symbol
+func symbol(n int) Expr {
+	return Expr{Terms: []Term{{n, 1}}}
+}
+
+// IsConstant reports whether the expression does not depend on any input
+func (e Expr) IsConstant() bool {
+	return len(e.Terms) == 0
+}
+
+// Eval computes the value of the expression for the given inputs
+func (e Expr) Eval(inputs []int) int {
+	value := e.Const
+	for _, term := range e.Terms {
+		value += term.Coeff * inputs[term.Symbol]
+	}
+	return value
+}
+
+// plus returns e + scale*other, reporting whether it was computed without overflow
+func (e Expr) plus(other Expr, scale int) (Expr, bool) {
+	scaled, exact := other.times(scale)
+	constant, ok := addInt(e.Const, scaled.Const)
+	exact = exact && ok
+	sum := Expr{Const: constant}
+	i, j := 0, 0
+	for i < len(e.Terms) || j < len(scaled.Terms) {
+		switch {
+		case j == len(scaled.Terms) || (i < len(e.Terms) && e.Terms[i].Symbol < scaled.Terms[j].Symbol):
+			sum.Terms = append(sum.Terms, e.Terms[i])
+			i++
+		case i == len(e.Terms) || scaled.Terms[j].Symbol < e.Terms[i].Symbol:
+			sum.Terms = append(sum.Terms, scaled.Terms[j])
+			j++
+		default:
+			coeff, ok := addInt(e.Terms[i].Coeff, scaled.Terms[j].Coeff)
+			exact = exact && ok
+			if coeff != 0 {
+				sum.Terms = append(sum.Terms, Term{e.Terms[i].Symbol, coeff})
+			}
+			i++
+			j++
+		}
+	}
+	return sum, exact
+}
+
+// times returns e multiplied by a constant, reporting whether it was computed without overflow
+func (e Expr) times(k int) (Expr, bool) {
+	if k == 0 {
+		return Expr{}, true
+	}
+	constant, exact := multiplyInt(e.Const, k)
+	product := Expr{Const: constant, Terms: make([]Term, len(e.Terms))}
+	for i, term := range e.Terms {
+		coeff, ok := multiplyInt(term.Coeff, k)
+		exact = exact && ok
+		product.Terms[i] = Term{term.Symbol, coeff}
+	}
+	return product, exact
+}
+
+func (e Expr) String() string {
+	return formatTerms(e.Terms, e.Const)
+}
+
+// formatTerms renders terms followed by a constant, omitting a zero constant unless there are no
+// terms
+func formatTerms(terms []Term, constant int) string {
+	var sb strings.Builder
+	for i, term := range terms {
+		coeff := term.Coeff
+		switch {
+		case i > 0 && coeff < 0:
+			sb.WriteString(" - ")
+			coeff = -coeff
+		case i > 0:
+			sb.WriteString(" + ")
+		case coeff == -1:
+			sb.WriteString("-")
+			coeff = 1
+		}
+		if coeff != 1 {
+			fmt.Fprintf(&sb, "%d*", coeff)
+		}
+		fmt.Fprintf(&sb, "in%d", term.Symbol)
+	}
+	switch {
+	case len(terms) == 0:
+		fmt.Fprintf(&sb, "%d", constant)
+	case constant < 0:
+		fmt.Fprintf(&sb, " - %d", -constant)
+	case constant > 0:
+		fmt.Fprintf(&sb, " + %d", constant)
+	}
+	return sb.String()
+}
+
+// Relation compares an expression with zero
+type Relation int
+
+const (
+	// RelationEqual requires an expression to be 0
+	RelationEqual Relation = iota
+	// RelationNotEqual requires an expression not to be 0
+	RelationNotEqual
+	// RelationLess requires an expression to be negative
+	RelationLess
+	// RelationGreaterEqual requires an expression to be 0 or more
+	RelationGreaterEqual
+)
+
+var relationSymbols = map[Relation]string{
+	RelationEqual:        "==",
+	RelationNotEqual:     "!=",
+	RelationLess:         "<",
+	RelationGreaterEqual: ">=",
+}
+
+// Constraint requires an expression to have a given Relation to 0
+type Constraint struct {
+	Expr     Expr
+	Relation Relation
+}
+
+// Holds reports whether the constraint is satisfied by the given inputs
+func (c Constraint) Holds(inputs []int) bool {
+	return c.Relation.holds(c.Expr.Eval(inputs))
+}
+
+func (r Relation) holds(value int) bool {
+	switch r {
+	case RelationEqual:
+		return value == 0
+	case RelationNotEqual:
+		return value != 0
+	case RelationLess:
+		return value < 0
+	}
+	return value >= 0
+}
+
+// String renders the constraint with the constant moved to the right hand side
+func (c Constraint) String() string {
+	return fmt.Sprintf("%s %s %d", formatTerms(c.Expr.Terms, 0), relationSymbols[c.Relation], -c.Expr.Const)
+}
+
+// SymbolicEnd describes why a symbolic path stopped
+type SymbolicEnd int
+
+const (
+	// SymbolicHalted paths executed HCF
+	SymbolicHalted SymbolicEnd = iota
+	// SymbolicReached paths reached the target address or output
+	SymbolicReached
+	// SymbolicFailed paths hit an instruction which could not be executed symbolically
+	SymbolicFailed
+	// SymbolicLimit paths executed MaxSteps instructions without stopping
+	SymbolicLimit
+)
+
+func (e SymbolicEnd) String() string {
+	switch e {
+	case SymbolicHalted:
+		return "halted"
+	case SymbolicReached:
+		return "reached"
+	case SymbolicFailed:
+		return "failed"
+	case SymbolicLimit:
+		return "limit"
+	}
+	return fmt.Sprintf("SymbolicEnd(%d)", int(e))
+}
+
+// SymbolicPath is a feasible path through a program
+type SymbolicPath struct {
+	End SymbolicEnd
+	// Address is the instruction pointer when the path stopped
+	Address int
+	// Reason explains why a SymbolicFailed path stopped
+	Reason string
+	// Constraints must all hold for the inputs to follow this path
+	Constraints []Constraint
+	// Outputs holds the values output along the path
+	Outputs []Expr
+	// Inputs is the number of values input along the path, including any fixed inputs
+	Inputs int
+	// Solution is a set of inputs which follows the path
+	Solution []int
+}
+
+// SymbolicExplorer executes a program over the M19 instruction set with symbolic inputs, forking
+// at each branch which depends on them
+//
+// Arithmetic must remain linear in the inputs, and inputs may not be used as addresses, jump
+// targets or relative base adjustments; paths which do so end as SymbolicFailed. So do paths
+// whose expressions in the inputs overflow an int, either directly or over the range of inputs
+// given to the solver. Arithmetic on constants wraps, as the machine's does.
+type SymbolicExplorer struct {
+	// FixedInputs are supplied as concrete values before any symbolic inputs are read
+	FixedInputs []int
+	// InputMin and InputMax bound the values the solver considers for each symbolic input
+	InputMin, InputMax int
+	// MaxSteps limits the instructions executed along each path
+	MaxSteps int
+	// MaxPaths limits the number of paths explored, with later branches left unexplored
+	MaxPaths int
+	// SolverBudget limits the search made by the solver for each set of constraints
+	SolverBudget int
+
+	image  memoryImage
+	ip, rb int
+}
+
+// NewSymbolicExplorer prepares to explore a program from address 0
+func NewSymbolicExplorer(program string) (*SymbolicExplorer, error) {
+	values, err := parseProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	return newSymbolicExplorer(newMemoryImage(values), 0, 0), nil
+}
+
+// SymbolicExplorer prepares to explore the program in the machine's RAM from its current state,
+// taking any queued input as fixed inputs
+func (m *Machine) SymbolicExplorer() *SymbolicExplorer {
+	e := newSymbolicExplorer(m.ramImage(), m.Register(RegisterInstructionPointer), m.Register(M19RelativeBase))
+	e.FixedInputs = append([]int{}, m.inputQueue...)
+	return e
+}
+
+func newSymbolicExplorer(image memoryImage, ip, rb int) *SymbolicExplorer {
+	return &SymbolicExplorer{
+		InputMin:     -1 << 20,
+		InputMax:     1 << 20,
+		MaxSteps:     100000,
+		MaxPaths:     1000,
+		SolverBudget: 10000,
+		image:        image,
+		ip:           ip,
+		rb:           rb,
+	}
+}
+
+// Explore follows every feasible path until it stops
+func (e *SymbolicExplorer) Explore() ([]*SymbolicPath, error) {
+	return e.explore(-1, nil)
+}
+
+// Reach finds the feasible paths which reach the instruction at addr
+func (e *SymbolicExplorer) Reach(addr int) ([]*SymbolicPath, error) {
+	return e.explore(addr, nil)
+}
+
+// ReachOutput finds the feasible paths which output value, stopping each at its first such output
+func (e *SymbolicExplorer) ReachOutput(value int) ([]*SymbolicPath, error) {
+	return e.explore(-1, &value)
+}
+
+// symbolicState is a path being explored
+type symbolicState struct {
+	ip, rb      int
+	memory      map[int]Expr
+	inputs      int
+	constraints []Constraint
+	outputs     []Expr
+	steps       int
+}
+
+func (s *symbolicState) fork() *symbolicState {
+	copied := *s
+	copied.memory = make(map[int]Expr, len(s.memory))
+	for addr, value := range s.memory {
+		copied.memory[addr] = value
+	}
+	copied.constraints = append([]Constraint{}, s.constraints...)
+	copied.outputs = append([]Expr{}, s.outputs...)
+	return &copied
+}
+
+func (e *SymbolicExplorer) explore(target int, output *int) ([]*SymbolicPath, error) {
+	exploreAll := target < 0 && output == nil
+	paths := []*SymbolicPath{}
+	pending := []*symbolicState{{ip: e.ip, rb: e.rb, memory: map[int]Expr{}}}
+	truncated := false
+	for explored := 1; len(pending) > 0; explored++ {
+		s := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+	path:
+		for {
+			if s.ip == target {
+				paths = e.report(paths, s, SymbolicReached, "")
+				break
+			}
+			if s.steps >= e.MaxSteps {
+				if exploreAll {
+					paths = e.report(paths, s, SymbolicLimit, "")
+				}
+				break
+			}
+			result := e.step(s)
+			if result.alt != nil {
+				if explored+len(pending) >= e.MaxPaths {
+					truncated = true
+				} else if _, feasible := e.solve(result.alt); feasible {
+					pending = append(pending, result.alt)
+				}
+				if _, feasible := e.solve(s); !feasible {
+					break
+				}
+			}
+			switch {
+			case result.failed != "":
+				if exploreAll {
+					paths = e.report(paths, s, SymbolicFailed, result.failed)
+				}
+				break path
+			case result.halted:
+				if exploreAll {
+					paths = e.report(paths, s, SymbolicHalted, "")
+				}
+				break path
+			case result.output && output != nil:
+				difference, exact := s.outputs[len(s.outputs)-1].plus(Constant(*output), -1)
+				if !exact || !e.bounded(difference) {
+					break path
+				}
+				matched := s.fork()
+				if matched.require(Constraint{difference, RelationEqual}) {
+					paths = e.report(paths, matched, SymbolicReached, "")
+				}
+				if !s.require(Constraint{difference, RelationNotEqual}) {
+					break path
+				}
+				if _, feasible := e.solve(s); !feasible {
+					break path
+				}
+			}
+		}
+	}
+	if truncated {
+		return paths, fmt.Errorf("Symbolic execution abandoned paths beyond the first %d", e.MaxPaths)
+	}
+	return paths, nil
+}
+
+// report adds a path for a state if its constraints can be solved
+func (e *SymbolicExplorer) report(paths []*SymbolicPath, s *symbolicState, end SymbolicEnd, reason string) []*SymbolicPath {
+	solution, feasible := e.solve(s)
+	if !feasible {
+		return paths
+	}
+	return append(paths, &SymbolicPath{
+		End:         end,
+		Address:     s.ip,
+		Reason:      reason,
+		Constraints: append([]Constraint{}, s.constraints...),
+		Outputs:     append([]Expr{}, s.outputs...),
+		Inputs:      s.inputs,
+		Solution:    solution,
+	})
+}
+
+// require adds a constraint to the state, returning false if it is constant and does not hold
+func (s *symbolicState) require(c Constraint) bool {
+	if c.Expr.IsConstant() {
+		return c.Relation.holds(c.Expr.Const)
+	}
+	s.constraints = append(s.constraints, c)
+	return true
+}
+
+func (s *symbolicState) load(addr int, image memoryImage) Expr {
+	if value, found := s.memory[addr]; found {
+		return value
+	}
+	if image.contains(addr) {
+		return Constant(image.value(addr))
+	}
+	return Expr{}
+}
+
+// symbolicStep is the outcome of executing one instruction symbolically
+type symbolicStep struct {
+	// alt is the state following the other side of a branch on a symbolic value
+	alt    *symbolicState
+	output bool
+	halted bool
+	failed string
+}
+
+// symbolicParam is a resolved instruction parameter
+type symbolicParam struct {
+	immediate bool
+	addr      int
+	value     Expr
+}
+
+// step executes the instruction at the state's instruction pointer
+func (e *SymbolicExplorer) step(s *symbolicState) symbolicStep {
+	fail := func(format string, args ...interface{}) symbolicStep {
+		return symbolicStep{failed: fmt.Sprintf(format, args...) + fmt.Sprintf(" at %v", address(s.ip))}
+	}
+	if s.ip < 0 {
+		return fail("negative address")
+	}
+	raw := s.load(s.ip, e.image)
+	if !raw.IsConstant() {
+		return fail("symbolic instruction")
+	}
+	def, modes, valid := decodeM19(raw.Const)
+	if !valid {
+		return fail("invalid opcode %d", raw.Const)
+	}
+	params := make([]symbolicParam, len(modes))
+	for i, mode := range modes {
+		value := s.load(s.ip+1+i, e.image)
+		if mode == ModeImmediate {
+			params[i] = symbolicParam{immediate: true, value: value}
+			continue
+		}
+		if !value.IsConstant() {
+			return fail("symbolic address in parameter %d", i+1)
+		}
+		addr := value.Const
+		switch mode {
+		case ModePositional:
+		case ModeRelative:
+			addr += s.rb
+		default:
+			return fail("invalid mode %d in parameter %d", mode, i+1)
+		}
+		if addr < 0 {
+			return fail("negative address in parameter %d", i+1)
+		}
+		params[i] = symbolicParam{addr: addr, value: s.load(addr, e.image)}
+	}
+	if def.WriteParam >= 0 && params[def.WriteParam].immediate {
+		return fail("write to immediate parameter")
+	}
+	write := func(st *symbolicState, value Expr) {
+		st.memory[params[def.WriteParam].addr] = value
+	}
+	// Overflow matters only once an expression depends on the inputs
+	overflowed := func(value Expr, exact bool) bool {
+		return !exact && !value.IsConstant()
+	}
+
+	result := symbolicStep{}
+	next := s.ip + 1 + def.NumParams
+	switch def.Code {
+	case m19OpAdd:
+		sum, exact := params[0].value.plus(params[1].value, 1)
+		if overflowed(sum, exact) {
+			return fail("coefficient overflow")
+		}
+		write(s, sum)
+	case m19OpMultiply:
+		a, b := params[0].value, params[1].value
+		var product Expr
+		var exact bool
+		switch {
+		case a.IsConstant():
+			product, exact = b.times(a.Const)
+		case b.IsConstant():
+			product, exact = a.times(b.Const)
+		default:
+			return fail("non-linear multiplication")
+		}
+		if overflowed(product, exact) {
+			return fail("coefficient overflow")
+		}
+		write(s, product)
+	case m19OpInput:
+		value := symbol(s.inputs)
+		if s.inputs < len(e.FixedInputs) {
+			value = Constant(e.FixedInputs[s.inputs])
+		}
+		s.inputs++
+		write(s, value)
+	case m19OpOutput:
+		s.outputs = append(s.outputs, params[0].value)
+		result.output = true
+	case m19OpJumpTrue, m19OpJumpFalse:
+		test, target := params[0].value, params[1].value
+		if !target.IsConstant() {
+			return fail("symbolic jump target")
+		}
+		if test.IsConstant() {
+			if (test.Const != 0) == (def.Code == m19OpJumpTrue) {
+				next = target.Const
+			}
+			break
+		}
+		if !e.bounded(test) {
+			return fail("coefficient overflow")
+		}
+		jump, stay := RelationNotEqual, RelationEqual
+		if def.Code == m19OpJumpFalse {
+			jump, stay = stay, jump
+		}
+		result.alt = s.fork()
+		result.alt.require(Constraint{test, stay})
+		result.alt.ip = next
+		result.alt.steps++
+		s.require(Constraint{test, jump})
+		next = target.Const
+	case m19OpLess, m19OpEqual:
+		difference, exact := params[0].value.plus(params[1].value, -1)
+		if overflowed(difference, exact) || (!difference.IsConstant() && !e.bounded(difference)) {
+			return fail("coefficient overflow")
+		}
+		holds, fails := RelationLess, RelationGreaterEqual
+		if def.Code == m19OpEqual {
+			holds, fails = RelationEqual, RelationNotEqual
+		}
+		if difference.IsConstant() {
+			value := 0
+			if holds.holds(difference.Const) {
+				value = 1
+			}
+			write(s, Constant(value))
+			break
+		}
+		result.alt = s.fork()
+		result.alt.require(Constraint{difference, fails})
+		write(result.alt, Constant(0))
+		result.alt.ip = next
+		result.alt.steps++
+		s.require(Constraint{difference, holds})
+		write(s, Constant(1))
+	case m19OpAdjustRelativeBase:
+		if !params[0].value.IsConstant() {
+			return fail("symbolic relative base adjustment")
+		}
+		s.rb += params[0].value.Const
+	case m19OpHCF:
+		result.halted = true
+		return result
+	default:
+		return fail("invalid opcode %d", raw.Const)
+	}
+	s.ip = next
+	s.steps++
+	return result
+}
+
+// bounded reports whether an expression stays within an int, with room to spare, over the range
+// of inputs given to the solver, so that the solver's bound arithmetic cannot overflow
+func (e *SymbolicExplorer) bounded(expr Expr) bool {
+	limit := func(symbol int) (int, bool) {
+		if symbol < len(e.FixedInputs) {
+			return absInt(e.FixedInputs[symbol])
+		}
+		low, lowExact := absInt(e.InputMin)
+		high, highExact := absInt(e.InputMax)
+		if high > low {
+			low = high
+		}
+		return low, lowExact && highExact
+	}
+	size, exact := absInt(expr.Const)
+	for _, term := range expr.Terms {
+		value, ok := limit(term.Symbol)
+		exact = exact && ok
+		coeff, ok := absInt(term.Coeff)
+		exact = exact && ok
+		product, ok := multiplyInt(coeff, value)
+		exact = exact && ok
+		size, ok = addInt(size, product)
+		exact = exact && ok
+	}
+	_, ok := addInt(size, 1)
+	return exact && ok
+}
+
+func absInt(a int) (int, bool) {
+	if a < 0 {
+		return multiplyInt(a, -1)
+	}
+	return a, true
+}
+
+// solve finds inputs satisfying the constraints of a state, within the solver's budget
+func (e *SymbolicExplorer) solve(s *symbolicState) ([]int, bool) {
+	lo, hi := make([]int, s.inputs), make([]int, s.inputs)
+	for i := range lo {
+		lo[i], hi[i] = e.InputMin, e.InputMax
+		if i < len(e.FixedInputs) {
+			lo[i], hi[i] = e.FixedInputs[i], e.FixedInputs[i]
+		}
+	}
+	budget := e.SolverBudget
+	return solveLinear(s.constraints, lo, hi, &budget)
+}
+
+// solveLinear searches for integers between lo and hi satisfying a set of linear constraints,
+// preferring values close to 0
+//
+// Bounds are tightened by propagating the constraints before each choice, and the search gives up
+// once budget choices have been made. Each constraint must stay within an int over the bounds
+// given, as checked by SymbolicExplorer.bounded, so that propagation does not overflow.
+func solveLinear(constraints []Constraint, lo, hi []int, budget *int) ([]int, bool) {
+	if *budget <= 0 {
+		return nil, false
+	}
+	*budget--
+	lo, hi = append([]int{}, lo...), append([]int{}, hi...)
+	if !propagate(constraints, lo, hi) {
+		return nil, false
+	}
+
+	choice := -1
+	for i := range lo {
+		if lo[i] < hi[i] && (choice < 0 || hi[i]-lo[i] < hi[choice]-lo[choice]) {
+			choice = i
+		}
+	}
+	if choice < 0 {
+		for _, c := range constraints {
+			if !c.Holds(lo) {
+				return nil, false
+			}
+		}
+		return lo, true
+	}
+
+	value := 0
+	switch {
+	case value < lo[choice]:
+		value = lo[choice]
+	case value > hi[choice]:
+		value = hi[choice]
+	}
+	ranges := [][2]int{{value, value}, {lo[choice], value - 1}, {value + 1, hi[choice]}}
+	for _, r := range ranges {
+		if r[0] > r[1] {
+			continue
+		}
+		lo[choice], hi[choice] = r[0], r[1]
+		if solution, found := solveLinear(constraints, lo, hi, budget); found {
+			return solution, true
+		}
+	}
+	return nil, false
+}
+
+// propagate tightens the bounds of each symbol to those allowed by the constraints, returning
+// false if they cannot be satisfied
+func propagate(constraints []Constraint, lo, hi []int) bool {
+	for round := 0; round < 64; round++ {
+		changed := false
+		for _, c := range constraints {
+			// Constraints are bounded, so these cannot overflow
+			negated, _ := c.Expr.times(-1)
+			var ok bool
+			switch c.Relation {
+			case RelationEqual:
+				ok = atMostZero(c.Expr, lo, hi, &changed) && atMostZero(negated, lo, hi, &changed)
+			case RelationLess:
+				succ, _ := c.Expr.plus(Constant(1), 1)
+				ok = atMostZero(succ, lo, hi, &changed)
+			case RelationGreaterEqual:
+				ok = atMostZero(negated, lo, hi, &changed)
+			case RelationNotEqual:
+				ok = notZero(c.Expr, lo, hi, &changed)
+			}
+			if !ok {
+				return false
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return true
+}
+
+// atMostZero tightens bounds so that expr <= 0 remains possible
+func atMostZero(expr Expr, lo, hi []int, changed *bool) bool {
+	minTerm := func(term Term) int {
+		if term.Coeff > 0 {
+			return term.Coeff * lo[term.Symbol]
+		}
+		return term.Coeff * hi[term.Symbol]
+	}
+	minimum := expr.Const
+	for _, term := range expr.Terms {
+		minimum += minTerm(term)
+	}
+	if minimum > 0 {
+		return false
+	}
+	for _, term := range expr.Terms {
+		limit := -(minimum - minTerm(term))
+		if term.Coeff > 0 {
+			if bound := floorDiv(limit, term.Coeff); bound < hi[term.Symbol] {
+				hi[term.Symbol] = bound
+				*changed = true
+			}
+		} else if bound := ceilDiv(limit, term.Coeff); bound > lo[term.Symbol] {
+			lo[term.Symbol] = bound
+			*changed = true
+		}
+		if lo[term.Symbol] > hi[term.Symbol] {
+			return false
+		}
+	}
+	return true
+}
+
+// notZero excludes the value of the last undecided symbol which would make expr 0, where it is at
+// the edge of the symbol's bounds
+func notZero(expr Expr, lo, hi []int, changed *bool) bool {
+	rest := expr.Const
+	open := -1
+	for i, term := range expr.Terms {
+		switch {
+		case lo[term.Symbol] == hi[term.Symbol]:
+			rest += term.Coeff * lo[term.Symbol]
+		case open >= 0:
+			return true
+		default:
+			open = i
+		}
+	}
+	if open < 0 {
+		return rest != 0
+	}
+	term := expr.Terms[open]
+	if rest%term.Coeff != 0 {
+		return true
+	}
+	excluded := -rest / term.Coeff
+	switch excluded {
+	case lo[term.Symbol]:
+		lo[term.Symbol]++
+		*changed = true
+	case hi[term.Symbol]:
+		hi[term.Symbol]--
+		*changed = true
+	}
+	return lo[term.Symbol] <= hi[term.Symbol]
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func ceilDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) == (b < 0) {
+		q++
+	}
+	return q
+}
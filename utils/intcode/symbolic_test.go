@@ -0,0 +1,154 @@
+package intcode
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// symbolicTestSource outputs 1 if its two inputs sum to 10 and the first is at least 3, or 0
+// otherwise
+const symbolicTestSource = `
+	        INP  [x]
+	        INP  [y]
+	        ADD  [x], [y], [sum]
+	        CEQ  [sum], 10, [t]
+	        JEZ  [t], fail
+	        CLT  [x], 3, [t]
+	        JNZ  [t], fail
+	win:    OUT  1
+	        HCF
+	fail:   OUT  0
+	        HCF
+	x:      DATA 0
+	y:      DATA 0
+	sum:    DATA 0
+	t:      DATA 0
+`
+
+func constraintStrings(path *SymbolicPath) []string {
+	lines := make([]string, len(path.Constraints))
+	for i, c := range path.Constraints {
+		lines[i] = c.String()
+	}
+	return lines
+}
+
+func TestSymbolicReach(t *testing.T) {
+	program, err := Assemble(symbolicTestSource)
+	assert.NoError(t, err)
+	e, err := NewSymbolicExplorer(program)
+	assert.NoError(t, err)
+
+	paths, err := e.Reach(22)
+	assert.NoError(t, err)
+	if assert.Len(t, paths, 1) {
+		assert.Equal(t, SymbolicReached, paths[0].End)
+		assert.Equal(t, []string{"in0 + in1 == 10", "in0 >= 3"}, constraintStrings(paths[0]))
+		assert.Equal(t, []int{3, 7}, paths[0].Solution)
+	}
+
+	paths, err = e.ReachOutput(0)
+	assert.NoError(t, err)
+	if assert.Len(t, paths, 2) {
+		assert.Equal(t, []string{"in0 + in1 == 10", "in0 < 3"}, constraintStrings(paths[0]))
+		assert.Equal(t, []int{0, 10}, paths[0].Solution)
+		assert.Equal(t, []string{"in0 + in1 != 10"}, constraintStrings(paths[1]))
+		assert.Equal(t, []int{0, 0}, paths[1].Solution)
+	}
+	for _, path := range paths {
+		m := NewMachine(M19(nil, nil))
+		assert.NoError(t, m.LoadProgram(program))
+		m.QueueInput(path.Solution...)
+		m.Run(false)
+		assert.Equal(t, 0, m.Register(M19RegisterOutput))
+	}
+
+	paths, err = e.Explore()
+	assert.NoError(t, err)
+	assert.Len(t, paths, 3)
+	for _, path := range paths {
+		assert.Equal(t, SymbolicHalted, path.End)
+	}
+
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram(program))
+	m.QueueInput(5)
+	paths, err = m.SymbolicExplorer().Reach(22)
+	assert.NoError(t, err)
+	if assert.Len(t, paths, 1) {
+		assert.Equal(t, []string{"in1 == 5"}, constraintStrings(paths[0]))
+		assert.Equal(t, []int{5, 5}, paths[0].Solution)
+	}
+}
+
+func TestSymbolicFailures(t *testing.T) {
+	type testDef struct {
+		program string
+		reason  string
+	}
+	tests := []testDef{
+		{"3,9,105,1,9,99", "symbolic jump target at #0002"},
+		{"3,9,2,9,9,10,99", "non-linear multiplication at #0002"},
+		{"3,9,1,9,9,10,209,10,99", "symbolic relative base adjustment at #0006"},
+		{"3,9,1001,9,0,6,99", "symbolic instruction at #0006"},
+		{"3,9,4,9,1101,1,1,-1,99", "negative address in parameter 3 at #0004"},
+		{"3,11,1002,11,4294967296,11,1002,11,4294967296,11,99", "coefficient overflow at #0006"},
+		{"3,11,1002,11,1125899906842624,11,1005,11,0,99", "coefficient overflow at #0006"},
+	}
+	for id, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", id), func(t *testing.T) {
+			e, err := NewSymbolicExplorer(test.program)
+			assert.NoError(t, err)
+			paths, err := e.Explore()
+			assert.NoError(t, err)
+			if assert.Len(t, paths, 1) {
+				assert.Equal(t, SymbolicFailed, paths[0].End)
+				assert.Equal(t, test.reason, paths[0].Reason)
+			}
+		})
+	}
+
+	e, err := NewSymbolicExplorer("3,9,1005,9,0,99")
+	assert.NoError(t, err)
+	e.MaxPaths = 3
+	e.MaxSteps = 30
+	paths, err := e.Explore()
+	assert.EqualError(t, err, "Symbolic execution abandoned paths beyond the first 3")
+	if assert.Len(t, paths, 3) {
+		assert.Equal(t, SymbolicLimit, paths[0].End)
+		assert.Len(t, paths[0].Constraints, 15)
+	}
+}
+
+func TestSolveLinear(t *testing.T) {
+	constraints := []Constraint{
+		{Expr{-12, []Term{{0, 2}, {1, 3}}}, RelationEqual},
+		{Expr{0, []Term{{0, 1}}}, RelationNotEqual},
+	}
+	budget := 100
+	solution, found := solveLinear(constraints, []int{0, 0}, []int{10, 10}, &budget)
+	assert.True(t, found)
+	assert.Equal(t, []int{6, 0}, solution)
+
+	constraints = append(constraints, Constraint{Expr{-1, []Term{{1, 1}}}, RelationEqual})
+	budget = 100
+	_, found = solveLinear(constraints, []int{0, 0}, []int{10, 10}, &budget)
+	assert.False(t, found)
+
+	assert.Equal(t, "2*in0 - in1 + 4", Expr{4, []Term{{0, 2}, {1, -1}}}.String())
+	assert.Equal(t, "-in2 < -4", Constraint{Expr{4, []Term{{2, -1}}}, RelationLess}.String())
+}
+
+func TestSymbolicFarAddress(t *testing.T) {
+	m := NewMachine(M19(nil, nil))
+	assert.NoError(t, m.LoadProgram("3,1099511627776,4,1099511627776,99"))
+	m.WriteRAM(80, 7)
+	paths, err := m.SymbolicExplorer().Explore()
+	assert.NoError(t, err)
+	if assert.Len(t, paths, 1) {
+		assert.Equal(t, SymbolicHalted, paths[0].End)
+		assert.Equal(t, "in0", paths[0].Outputs[0].String())
+	}
+}
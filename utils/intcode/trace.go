@@ -0,0 +1,204 @@
+package intcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TraceRecord describes a single executed instruction
+type TraceRecord struct {
+	Count        int            `json:"count"`
+	Address      int            `json:"address"`
+	Opcode       int            `json:"opcode"`
+	Mnemonic     string         `json:"mnemonic"`
+	Operands     []int          `json:"operands"`
+	Reads        []int          `json:"reads"`
+	Write        *TraceWrite    `json:"write,omitempty"`
+	RelativeBase int            `json:"relativeBase"`
+	Result       ExecReturnCode `json:"result"`
+}
+
+// TraceWrite describes the value written by an instruction
+type TraceWrite struct {
+	Address int `json:"address"`
+	Value   int `json:"value"`
+}
+
+func (r TraceRecord) String() string {
+	mnemonic := r.Mnemonic
+	if mnemonic == "" {
+		mnemonic = "???"
+	}
+	operands := make([]string, len(r.Operands))
+	for i, operand := range r.Operands {
+		operands[i] = address(operand).String()
+	}
+	reads := make([]string, len(r.Reads))
+	for i, read := range r.Reads {
+		reads[i] = fmt.Sprintf("%d", read)
+	}
+	line := fmt.Sprintf(
+		"%8d %v %5d %-3s [%s] read=[%s]",
+		r.Count, address(r.Address), r.Opcode, mnemonic,
+		strings.Join(operands, " "), strings.Join(reads, " "),
+	)
+	if r.Write != nil {
+		line += fmt.Sprintf(" write=%v<-%d", address(r.Write.Address), r.Write.Value)
+	}
+	line += fmt.Sprintf(" rb=%d", r.RelativeBase)
+	if r.Result != ExecRCNone {
+		line += fmt.Sprintf(" rc=%d", r.Result)
+	}
+	return line
+}
+
+// TraceSink receives a record for every instruction executed by a traced machine
+type TraceSink interface {
+	Record(TraceRecord)
+}
+
+// Trace records every executed instruction to the given sinks
+func Trace(sinks ...TraceSink) MachineOption {
+	return func(m *Machine) {
+		m.addHook(&tracer{
+			machine: m,
+			sinks:   sinks,
+		})
+	}
+}
+
+type tracer struct {
+	nopHook
+	machine *Machine
+	sinks   []TraceSink
+	current TraceRecord
+}
+
+func (t *tracer) beforeStep(ip address, op operation) {
+	t.current = TraceRecord{
+		Count:        t.machine.instructionCount + 1,
+		Address:      int(ip),
+		Opcode:       t.machine.readAddress(ip),
+		RelativeBase: t.machine.registers[M19RelativeBase],
+	}
+	if op == nil {
+		return
+	}
+	t.current.Mnemonic = op.Name()
+	for _, addr := range op.paramAddresses() {
+		t.current.Operands = append(t.current.Operands, int(addr))
+	}
+}
+
+func (t *tracer) memoryRead(addr address, value int) {
+	t.current.Reads = append(t.current.Reads, value)
+}
+
+func (t *tracer) memoryWrite(addr address, previous, value int) {
+	t.current.Write = &TraceWrite{Address: int(addr), Value: value}
+}
+
+func (t *tracer) afterStep(rc ExecReturnCode) {
+	t.current.Result = rc
+	for _, sink := range t.sinks {
+		sink.Record(t.current)
+	}
+}
+
+// TextTraceSink writes human-readable trace lines
+type TextTraceSink struct {
+	w   io.Writer
+	err error
+}
+
+// NewTextTraceSink creates a sink writing one line per instruction to w
+func NewTextTraceSink(w io.Writer) *TextTraceSink {
+	return &TextTraceSink{w: w}
+}
+
+// Record writes a trace record
+func (s *TextTraceSink) Record(record TraceRecord) {
+	if s.err == nil {
+		_, s.err = fmt.Fprintln(s.w, record)
+	}
+}
+
+// Err reports the first error encountered while writing
+func (s *TextTraceSink) Err() error {
+	return s.err
+}
+
+// JSONTraceSink writes trace records as JSON lines
+type JSONTraceSink struct {
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONTraceSink creates a sink writing one JSON object per instruction to w
+func NewJSONTraceSink(w io.Writer) *JSONTraceSink {
+	return &JSONTraceSink{enc: json.NewEncoder(w)}
+}
+
+// Record writes a trace record
+func (s *JSONTraceSink) Record(record TraceRecord) {
+	if s.err == nil {
+		s.err = s.enc.Encode(record)
+	}
+}
+
+// Err reports the first error encountered while writing
+func (s *JSONTraceSink) Err() error {
+	return s.err
+}
+
+// RingTraceSink keeps the most recent trace records in memory
+type RingTraceSink struct {
+	// DumpOnInvalid, if set, receives a dump of the buffer when an invalid instruction is hit
+	DumpOnInvalid io.Writer
+
+	records []TraceRecord
+	next    int
+	full    bool
+}
+
+// NewRingTraceSink creates a sink holding the last size records
+func NewRingTraceSink(size int) *RingTraceSink {
+	return &RingTraceSink{
+		records: make([]TraceRecord, size),
+	}
+}
+
+// Record stores a trace record, discarding the oldest if the buffer is full
+func (s *RingTraceSink) Record(record TraceRecord) {
+	if len(s.records) > 0 {
+		s.records[s.next] = record
+		s.next = (s.next + 1) % len(s.records)
+		if s.next == 0 {
+			s.full = true
+		}
+	}
+	if record.Result == ExecRCInvalidInstruction && s.DumpOnInvalid != nil {
+		fmt.Fprintf(s.DumpOnInvalid, "Invalid instruction at %v, last %d instructions:\n", address(record.Address), len(s.Records()))
+		s.Dump(s.DumpOnInvalid)
+	}
+}
+
+// Records returns the buffered records, oldest first
+func (s *RingTraceSink) Records() []TraceRecord {
+	if !s.full {
+		return append([]TraceRecord{}, s.records[:s.next]...)
+	}
+	return append(append([]TraceRecord{}, s.records[s.next:]...), s.records[:s.next]...)
+}
+
+// Dump writes the buffered records as text
+func (s *RingTraceSink) Dump(w io.Writer) error {
+	for _, record := range s.Records() {
+		if _, err := fmt.Fprintln(w, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package intcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceText(t *testing.T) {
+	out := &bytes.Buffer{}
+	m := NewMachine(M19(nil, nil), Trace(NewTextTraceSink(out)))
+	assert.NoError(t, m.LoadProgram("109,3,22201,0,1,2,204,2,99"))
+	m.Run(false)
+
+	expected := []string{
+		"       1 #0000   109 ARB [#0001] read=[3] rb=0",
+		"       2 #0002 22201 ADD [#0003 #0004 #0005] read=[0 1] write=#0005<-1 rb=3",
+		"       3 #0006   204 OUT [#0005] read=[1] rb=3 rc=3",
+		"       4 #0008    99 HCF [] read=[] rb=3 rc=2",
+	}
+	assert.Equal(t, strings.Join(expected, "\n")+"\n", out.String())
+}
+
+func TestTraceJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	m := NewMachine(M19(nil, nil), Trace(NewJSONTraceSink(out)))
+	assert.NoError(t, m.LoadProgram("1,5,6,7,99,20,22,0"))
+	m.Run(false)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var record TraceRecord
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, TraceRecord{
+		Count:    1,
+		Address:  0,
+		Opcode:   1,
+		Mnemonic: "ADD",
+		Operands: []int{5, 6, 7},
+		Reads:    []int{20, 22},
+		Write:    &TraceWrite{Address: 7, Value: 42},
+	}, record)
+}
+
+func TestTraceRing(t *testing.T) {
+	ring := NewRingTraceSink(3)
+	dump := &bytes.Buffer{}
+	ring.DumpOnInvalid = dump
+
+	m := NewMachine(M19(nil, nil), Trace(ring))
+	assert.NoError(t, m.LoadProgram("1101,1,1,13,1101,2,2,14,1105,1,12,0,42,0,0"))
+	for i := 0; i < 2; i++ {
+		m.Step()
+	}
+	assert.Len(t, ring.Records(), 2)
+	assert.Empty(t, dump.String())
+
+	m.Run(false)
+	assert.True(t, errors.Is(m.Err(), ErrInvalidOpcode))
+	records := ring.Records()
+	assert.Len(t, records, 3)
+	assert.Equal(t, []int{2, 3, 4}, []int{records[0].Count, records[1].Count, records[2].Count})
+	assert.Equal(t, ExecRCInvalidInstruction, records[2].Result)
+	assert.Equal(t, 12, records[2].Address)
+
+	expected := []string{
+		"Invalid instruction at #0012, last 3 instructions:",
+		"       2 #0004  1101 ADD [#0005 #0006 #0014] read=[2 2] write=#0014<-4 rb=0",
+		"       3 #0008  1105 JNZ [#0009 #0010] read=[1 12] rb=0",
+		"       4 #0012    42 ??? [] read=[] rb=0 rc=1",
+	}
+	assert.Equal(t, strings.Join(expected, "\n")+"\n", dump.String())
+}